@@ -1,37 +1,102 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/alecthomas/kong"
+	"github.com/matperez/flibusta-parser/internal/covers"
 	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
 	"github.com/matperez/flibusta-parser/internal/pool"
 	storage2 "github.com/matperez/flibusta-parser/internal/storage"
 	"github.com/matperez/flibusta-parser/internal/work"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
 )
 
 var flb flibusta2.Client
 var db *gorm.DB
 
-func MakeDBConnection() *gorm.DB {
-	dsn := fmt.Sprintf(
+//MakeDSN builds the connection string of the database driver
+func MakeDSN() string {
+	switch CLI.DbDriver {
+	case storage2.DriverPostgres:
+		server := CLI.DbServer
+		if server == "" {
+			server = "localhost:5432"
+		}
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(CLI.DbUser, CLI.DbPassword),
+			Host:     server,
+			Path:     "/" + CLI.DbName,
+			RawQuery: "sslmode=disable",
+		}
+		return dsn.String()
+	case storage2.DriverSQLite:
+		// для SQLite имя базы это путь к файлу, транзакции сразу берут блокировку записи,
+		// иначе чтение с последующей записью в конкурентных транзакциях падает с database is locked
+		path := CLI.DbName
+		if filepath.Ext(path) == "" {
+			path += ".db"
+		}
+		return path + "?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+	}
+	server := CLI.DbServer
+	if server == "" {
+		server = "localhost:3306"
+	}
+	return fmt.Sprintf(
 		"%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
 		CLI.DbUser,
 		CLI.DbPassword,
-		CLI.DbServer,
+		server,
 		CLI.DbName,
 	)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+}
+
+func MakeDBConnection() *gorm.DB {
+	if CLI.DbDriver != storage2.DriverSQLite && CLI.DbUser == "" {
+		log.Fatalf("the database user must be set for the %s driver", CLI.DbDriver)
+	}
+	db, err := storage2.Open(CLI.DbDriver, MakeDSN(), &gorm.Config{})
 	if err != nil {
 		log.Fatal(err)
 	}
 	return db
 }
 
-func CreateFlibustaClient() flibusta2.Client {
-	client, err := flibusta2.NewFlibusta()
+//CreateRateLimit returns the rate limit tuned by the parse flags or the default one
+func CreateRateLimit(command string) flibusta2.RateLimit {
+	limit := flibusta2.DefaultRateLimit
+	if command == "parse <from> <to>" {
+		limit.Rate = CLI.Parse.Rate
+		limit.Burst = CLI.Parse.Burst
+		limit.Jitter = CLI.Parse.Jitter
+		limit.MaxRetries = CLI.Parse.MaxRetries
+	}
+	return limit
+}
+
+func CreateFlibustaClient(limit flibusta2.RateLimit) flibusta2.Client {
+	client, err := flibusta2.NewFlibusta(flibusta2.Options{
+		RateLimit:      limit,
+		CookieFile:     CLI.CookieFile,
+		BaseURL:        CLI.BaseURL,
+		Mirrors:        CLI.Mirrors,
+		Proxy:          CLI.Proxy,
+		UserAgent:      CLI.UserAgent,
+		Timeout:        CLI.Timeout,
+		ConnectTimeout: CLI.ConnectTimeout,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -42,55 +107,429 @@ func CreateFlibustaClient() flibusta2.Client {
 	return client
 }
 
+func CreateWorkOptions() work.Options {
+	opts := work.Options{Retry: work.DefaultRetryPolicy, Reviews: CLI.Parse.Reviews}
+	if CLI.Parse.Attempts > 0 {
+		opts.Retry.Attempts = CLI.Parse.Attempts
+	}
+	if CLI.Parse.FetchCovers {
+		store, err := covers.NewStore(CLI.Parse.CoversDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Covers = store
+	}
+	return opts
+}
+
 func Migrate(db *gorm.DB) {
-	bookProto := &storage2.Book{}
-	authorProto := &storage2.Author{}
-	genreProto := &storage2.Genre{}
-	err := db.AutoMigrate(bookProto, authorProto, genreProto)
+	err := storage2.Migrate(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	SeedGenreGroups(db)
+}
+
+//SeedGenreGroups fills the genre taxonomy table with the known FB2 groups
+func SeedGenreGroups(db *gorm.DB) {
+	var groups []*storage2.GenreGroup
+	for _, g := range flibusta2.GenreGroups {
+		groups = append(groups, &storage2.GenreGroup{Code: g.Code, Title: g.Title})
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"title", "updated_at"}),
+	}).Create(&groups).Error
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
 var CLI struct {
-	DbServer         string `help:"Database server address and port" default:"localhost:3306"`
-	DbName           string `help:"Database name" default:"flibusta"`
-	DbUser           string `help:"Database user name" required:""`
-	DbPassword       string `help:"Database user password" required:""`
-	FlibustaUser     string `help:"Flibusta user name" required:""`
-	FlibustaPassword string `help:"Flibusta user password" required:""`
+	DbDriver         string        `help:"Database driver: mysql, postgres or sqlite" enum:"mysql,postgres,sqlite" default:"mysql"`
+	DbServer         string        `help:"Database server address and port, localhost with the default port of the driver if empty"`
+	DbName           string        `help:"Database name, the file path for sqlite" default:"flibusta"`
+	DbUser           string        `help:"Database user name, required by mysql and postgres"`
+	DbPassword       string        `help:"Database user password"`
+	FlibustaUser     string        `help:"Flibusta user name, required by the commands visiting the site"`
+	FlibustaPassword string        `help:"Flibusta user password, required by the commands visiting the site"`
+	CookieFile       string        `help:"File to keep the Flibusta session in between runs" type:"path"`
+	BaseURL          string        `help:"Flibusta site address" default:"https://flibusta.is" env:"FLIBUSTA_BASE_URL"`
+	Mirrors          []string      `help:"Mirror addresses tried in order when the site can not be reached" env:"FLIBUSTA_MIRRORS"`
+	Proxy            string        `help:"HTTP or SOCKS5 proxy address like socks5://127.0.0.1:9050" env:"FLIBUSTA_PROXY"`
+	UserAgent        string        `help:"User-Agent header sent to the site" env:"FLIBUSTA_USER_AGENT"`
+	Timeout          time.Duration `help:"Request timeout including the body download, zero disables it" default:"5m" env:"FLIBUSTA_TIMEOUT"`
+	ConnectTimeout   time.Duration `help:"Timeout of connecting to the site or the proxy" default:"30s" env:"FLIBUSTA_CONNECT_TIMEOUT"`
+	QueueSize        int           `help:"Jobs queued ahead of the workers" default:"100"`
 	Parse            struct {
-		WorkersCount int `help:"Workers count." short:"w" default:"4"`
-		From         int `arg:"" name:"from" help:"Initial book ID." required:""`
-		To           int `arg:"" name:"to" help:"Final book ID." required:""`
+		WorkersCount int           `help:"Workers count." short:"w" default:"4"`
+		FetchCovers  bool          `help:"Download book covers."`
+		CoversDir    string        `help:"Directory to store downloaded covers in." default:"covers"`
+		Rate         float64       `help:"Requests per second shared by all workers, zero disables the limit." default:"2"`
+		Burst        int           `help:"Requests allowed to go at once." default:"4"`
+		Jitter       time.Duration `help:"Maximum random delay added to every request." default:"500ms"`
+		MaxRetries   int           `help:"Retries of the requests refused with 429 or 503." default:"5"`
+		Attempts     int           `help:"Attempts to fetch a book failed with a transient error." default:"4"`
+		Resume       bool          `help:"Skip the books already stored or missing on the site by the previous runs."`
+		Reviews      bool          `help:"Store the public reviews of the users from the book pages."`
+		From         int           `arg:"" name:"from" help:"Initial book ID." required:""`
+		To           int           `arg:"" name:"to" help:"Final book ID." required:""`
 	} `cmd:"" help:"Run parsing."`
+	ParseAuthors struct {
+		WorkersCount int `help:"Workers count." short:"w" default:"4"`
+	} `cmd:"" help:"Parse pages of the authors already stored in the database."`
+	ParseSeries struct {
+		WorkersCount int `help:"Workers count." short:"w" default:"4"`
+	} `cmd:"" help:"Parse pages of the series already stored in the database."`
+	Sync struct {
+		WorkersCount int           `help:"Workers count." short:"w" default:"4"`
+		Interval     time.Duration `help:"Check for new books with the interval, zero checks only once." default:"0"`
+	} `cmd:"" help:"Parse books added since the last stored one."`
+	ImportSql struct {
+		BatchSize int    `help:"Rows count inserted at once." default:"1000"`
+		Dir       string `arg:"" name:"dir" help:"Directory with the lib.*.sql.gz dump files." type:"existingdir"`
+	} `cmd:"" help:"Import the official SQL dump files from https://flibusta.is/sql."`
+	Daily struct {
+		Fetch bool   `help:"Download the archives missing in the directory from https://flibusta.is/daily first."`
+		Dir   string `arg:"" name:"dir" help:"Directory with the daily fb2 zip archives." type:"existingdir"`
+	} `cmd:"" help:"Import books from the daily update archives."`
+	Download struct {
+		Format string `help:"Book format: fb2, html, txt, rtf, epub, mobi or empty for the original file." default:"fb2"`
+		Dir    string `help:"Directory to save books in." default:"books" type:"path"`
+		Layout string `help:"File path template with {id}, {title}, {author}, {series}, {number} and {format} placeholders." default:"${book_layout}"`
+		From   int    `arg:"" name:"from" help:"Initial book ID." required:""`
+		To     int    `arg:"" name:"to" help:"Final book ID." required:""`
+	} `cmd:"" help:"Download files of the stored books."`
+	History struct {
+		BookID uint `arg:"" name:"book-id" help:"Book ID."`
+	} `cmd:"" help:"Show how the stored book changed between the crawls."`
+	Trending struct {
+		Window time.Duration `help:"Period to measure the read count growth in." default:"168h"`
+		Limit  int           `help:"Books count to show." default:"20"`
+	} `cmd:"" help:"Rank the stored books by the read count growth per day."`
+	Recrawl struct {
+		WorkersCount int           `help:"Workers count." short:"w" default:"4"`
+		Window       time.Duration `help:"Period to measure the read count growth in." default:"168h"`
+		HotVelocity  float64       `help:"Reads per day making a book hot." default:"10"`
+		HotAge       time.Duration `help:"Parse the hot books again after the period." default:"24h"`
+		ColdAge      time.Duration `help:"Parse the other books again after the period." default:"720h"`
+		Interval     time.Duration `help:"Check for the books to parse again with the interval, zero checks only once." default:"0"`
+	} `cmd:"" help:"Parse the stored books again, the popular ones more often."`
 }
 
-func ParseCLIContext() {
+func ParseCLIContext() string {
 	ctx := kong.Parse(
 		&CLI,
 		kong.UsageOnError(),
 		kong.Name("parser"),
 		kong.Description("https://flibusta.is parser"),
+		kong.Vars{"book_layout": work.DefaultBookLayout},
 	)
 	switch ctx.Command() {
 	case "parse <from> <to>":
+	case "parse-authors":
+	case "parse-series":
+	case "sync":
+	case "import-sql <dir>":
+	case "daily <dir>":
+	case "download <from> <to>":
+	case "history <book-id>":
+	case "trending":
+	case "recrawl":
 	default:
 		panic(ctx.Command())
 	}
+	return ctx.Command()
+}
+
+//FinishPool closes the pool, waits for the in-flight jobs and logs the summary
+func FinishPool(ctx context.Context, workerPool *pool.Pool) {
+	if ctx.Err() != nil {
+		log.Printf("stopping, waiting for the jobs in progress")
+	}
+	workerPool.Close()
+	summary := workerPool.Wait()
+	log.Printf("processed %d jobs, %d failed", summary.Processed, summary.Failed)
+}
+
+func RunParse(ctx context.Context) {
+	jobs := work.CreateJobs(CLI.Parse.From, CLI.Parse.To)
+	if CLI.Parse.Resume {
+		var err error
+		if jobs, err = work.PendingJobs(db, CLI.Parse.From, CLI.Parse.To); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("resuming with %d books left in the range", len(jobs))
+	}
+
+	workerPool := pool.New(ctx, CLI.Parse.WorkersCount, CLI.QueueSize, work.NewHandler(db, flb, CreateWorkOptions())) // start up worker pool
+	defer FinishPool(ctx, workerPool)
+	go ResizeOnSignals(ctx, workerPool)
+
+	for i, job := range jobs {
+		if !workerPool.Submit(ctx, pool.Work{BookID: job, ID: i}) {
+			return
+		}
+	}
+}
+
+func RunParseAuthors(ctx context.Context) {
+	var ids []int
+	err := db.Model(&storage2.Author{}).Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	workerPool := pool.New(ctx, CLI.ParseAuthors.WorkersCount, CLI.QueueSize, work.NewHandler(db, flb, work.Options{})) // start up worker pool
+	defer FinishPool(ctx, workerPool)
+	go ResizeOnSignals(ctx, workerPool)
+
+	for i, id := range ids {
+		if !workerPool.Submit(ctx, pool.Work{AuthorID: id, ID: i}) {
+			return
+		}
+	}
+}
+
+func RunParseSeries(ctx context.Context) {
+	var ids []int
+	err := db.Model(&storage2.Series{}).Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	workerPool := pool.New(ctx, CLI.ParseSeries.WorkersCount, CLI.QueueSize, work.NewHandler(db, flb, work.Options{})) // start up worker pool
+	defer FinishPool(ctx, workerPool)
+	go ResizeOnSignals(ctx, workerPool)
+
+	for i, id := range ids {
+		if !workerPool.Submit(ctx, pool.Work{SeriesID: id, ID: i}) {
+			return
+		}
+	}
+}
+
+func RunSync(ctx context.Context) {
+	workerPool := pool.New(ctx, CLI.Sync.WorkersCount, CLI.QueueSize, work.NewHandler(db, flb, work.Options{Retry: work.DefaultRetryPolicy})) // start up worker pool
+	defer FinishPool(ctx, workerPool)
+	go ResizeOnSignals(ctx, workerPool)
+
+	// submitted - наибольший ID, уже отданный воркерам, SyncJobs не ставит в очередь книги до него повторно
+	var i, submitted int
+	for {
+		jobs, err := work.SyncJobs(ctx, db, flb, submitted)
+		if err != nil {
+			log.Printf("failed to get the new books: %s", err.Error())
+		}
+		for _, job := range jobs {
+			if !workerPool.Submit(ctx, pool.Work{BookID: job, ID: i}) {
+				return
+			}
+			submitted = job
+			i++
+		}
+		if CLI.Sync.Interval == 0 {
+			return
+		}
+		select {
+		case <-time.After(CLI.Sync.Interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func RunImportSQL() {
+	err := work.ImportDump(db, CLI.ImportSql.Dir, CLI.ImportSql.BatchSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func RunDaily(ctx context.Context) {
+	if CLI.Daily.Fetch {
+		err := work.FetchDailyArchives(ctx, flb, CLI.Daily.Dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	paths, err := filepath.Glob(filepath.Join(CLI.Daily.Dir, "*.zip"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		count, err := work.ImportDailyArchive(db, path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("imported %d books from %s", count, path)
+	}
+}
+
+func RunDownload(ctx context.Context) {
+	var books []*storage2.Book
+	err := db.
+		Preload("Contributors.Author").
+		Preload("Series.Series").
+		Where("id >= ? AND id < ? AND status = ?", CLI.Download.From, CLI.Download.To, flibusta2.StatusActive).
+		Order("id").
+		Find(&books).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, book := range books {
+		if ctx.Err() != nil {
+			return
+		}
+		file, err := work.DownloadBook(ctx, db, flb, CLI.Download.Dir, CLI.Download.Layout, CLI.Download.Format, book)
+		if err != nil {
+			log.Printf("failed to download the book [%d]: %s", book.ID, err.Error())
+			continue
+		}
+		log.Printf("downloaded the book [%d] to %s", book.ID, file.Path)
+	}
+}
+
+func RunHistory() {
+	revisions, err := storage2.BookHistory(db, CLI.History.BookID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(revisions) == 0 {
+		log.Fatalf("no revisions of the book [%d]", CLI.History.BookID)
+	}
+	for i, revision := range revisions {
+		changes, err := revision.FieldChanges()
+		if err != nil {
+			log.Fatal(err)
+		}
+		date := revision.CreatedAt.Local().Format("2006-01-02 15:04:05")
+		if i == 0 && len(changes) == 0 {
+			fmt.Printf("%s first crawled\n", date)
+			continue
+		}
+		fmt.Printf("%s changed\n", date)
+		for _, change := range changes {
+			fmt.Printf("  %s: %q -> %q\n", change.Field, change.Old, change.New)
+		}
+	}
+}
+
+func RunTrending() {
+	books, err := work.Trending(db, CLI.Trending.Window, time.Now(), CLI.Trending.Limit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i, book := range books {
+		fmt.Printf("%d. [%d] %s: %d reads, %+d in the window, %.1f per day\n", i+1, book.BookID, book.Title, book.ReadCount, book.Growth, book.PerDay)
+	}
+}
+
+func RunRecrawl(ctx context.Context) {
+	// queued - книги, отданные воркерам и еще не обработанные: пока они в очереди,
+	// повторная проверка не должна ставить их туда снова
+	var mu sync.Mutex
+	queued := map[int]bool{}
+	handler := work.NewHandler(db, flb, work.Options{Retry: work.DefaultRetryPolicy})
+	workerPool := pool.New(ctx, CLI.Recrawl.WorkersCount, CLI.QueueSize, func(ctx context.Context, job pool.Work) error {
+		defer func() {
+			mu.Lock()
+			delete(queued, job.BookID)
+			mu.Unlock()
+		}()
+		return handler(ctx, job)
+	}) // start up worker pool
+	defer FinishPool(ctx, workerPool)
+	go ResizeOnSignals(ctx, workerPool)
+
+	policy := work.RecrawlPolicy{
+		Window:      CLI.Recrawl.Window,
+		HotVelocity: CLI.Recrawl.HotVelocity,
+		HotAge:      CLI.Recrawl.HotAge,
+		ColdAge:     CLI.Recrawl.ColdAge,
+	}
+	var i int
+	for {
+		jobs, err := work.DueBooks(db, time.Now(), policy)
+		if err != nil {
+			log.Printf("failed to get the books due to be parsed again: %s", err.Error())
+		} else {
+			var fresh []int
+			mu.Lock()
+			for _, job := range jobs {
+				if !queued[job] {
+					queued[job] = true
+					fresh = append(fresh, job)
+				}
+			}
+			mu.Unlock()
+			log.Printf("%d books are due to be parsed again, %d of them are still queued", len(jobs), len(jobs)-len(fresh))
+			for _, job := range fresh {
+				if !workerPool.Submit(ctx, pool.Work{BookID: job, ID: i}) {
+					return
+				}
+				i++
+			}
+		}
+		if CLI.Recrawl.Interval == 0 {
+			return
+		}
+		select {
+		case <-time.After(CLI.Recrawl.Interval):
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
 func main() {
-	ParseCLIContext()
+	command := ParseCLIContext()
 
 	db = MakeDBConnection()
 	Migrate(db)
 
-	flb = CreateFlibustaClient()
+	// команды, работающие только с локальными файлами, не требуют авторизации на сайте
+	switch {
+	case command == "import-sql <dir>":
+		RunImportSQL()
+		return
+	case command == "daily <dir>" && !CLI.Daily.Fetch:
+		RunDaily(context.Background())
+		return
+	case command == "history <book-id>":
+		RunHistory()
+		return
+	case command == "trending":
+		RunTrending()
+		return
+	}
 
-	collector := pool.StartDispatcher(CLI.Parse.WorkersCount, db, flb) // start up worker pool
+	flb = CreateFlibustaClient(CreateRateLimit(command))
 
-	for i, job := range work.CreateJobs(CLI.Parse.From, CLI.Parse.To) {
-		collector.Work <- pool.Work{BookID: job, ID: i}
+	// по сигналу новые задачи не раздаются, а начатые доделываются
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// повторный сигнал завершает процесс сразу
+		<-ctx.Done()
+		stop()
+	}()
+
+	switch command {
+	case "parse <from> <to>":
+		RunParse(ctx)
+	case "parse-authors":
+		RunParseAuthors(ctx)
+	case "parse-series":
+		RunParseSeries(ctx)
+	case "sync":
+		RunSync(ctx)
+	case "daily <dir>":
+		RunDaily(ctx)
+	case "download <from> <to>":
+		RunDownload(ctx)
+	case "recrawl":
+		RunRecrawl(ctx)
 	}
 }
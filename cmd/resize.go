@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"github.com/matperez/flibusta-parser/internal/pool"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+//ResizeOnSignals adds a worker to the pool on SIGUSR1 and removes one on SIGUSR2 until the context is done
+func ResizeOnSignals(ctx context.Context, workerPool *pool.Pool) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			size := workerPool.Size()
+			if sig == syscall.SIGUSR1 {
+				size++
+			} else {
+				size--
+			}
+			if err := workerPool.Resize(size); err != nil {
+				log.Printf("failed to resize the worker pool: %s", err.Error())
+				continue
+			}
+			log.Printf("the worker pool is resized to %d workers", size)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package main
+
+import (
+	"context"
+	"github.com/matperez/flibusta-parser/internal/pool"
+)
+
+//ResizeOnSignals does nothing on Windows which has no SIGUSR1 and SIGUSR2
+func ResizeOnSignals(ctx context.Context, workerPool *pool.Pool) {}
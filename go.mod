@@ -8,5 +8,7 @@ require (
 	github.com/pkg/errors v0.9.1
 	golang.org/x/net v0.0.0-20210326220855-61e056675ecf
 	gorm.io/driver/mysql v1.0.5
+	gorm.io/driver/postgres v1.0.8
+	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.21.6
 )
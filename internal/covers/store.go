@@ -0,0 +1,77 @@
+package covers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+//Image describes a stored cover image
+type Image struct {
+	Hash     string
+	Path     string
+	MimeType string
+	Width    int
+	Height   int
+	Size     int
+}
+
+//Store keeps cover images on disk addressed by the sha256 of their content
+type Store struct {
+	dir string
+}
+
+//NewStore creates a store in the given directory
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "error creating the covers directory")
+	}
+	return &Store{dir: dir}, nil
+}
+
+//Save writes the image content to the store unless it is already there
+func (s *Store) Save(content []byte) (*Image, error) {
+	sum := sha256.Sum256(content)
+	img := &Image{
+		Hash:     hex.EncodeToString(sum[:]),
+		MimeType: http.DetectContentType(content),
+		Size:     len(content),
+	}
+	img.Path = filepath.Join(s.dir, img.Hash[0:2], img.Hash[2:4], img.Hash)
+	// размеры известны только для поддерживаемых форматов, остальные сохраняем как есть
+	if config, _, err := image.DecodeConfig(bytes.NewReader(content)); err == nil {
+		img.Width = config.Width
+		img.Height = config.Height
+	}
+	if _, err := os.Stat(img.Path); err == nil {
+		return img, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(img.Path), 0755); err != nil {
+		return nil, errors.Wrap(err, "error creating the cover directory")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(img.Path), img.Hash+".*")
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating a temporary cover file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		return nil, errors.Wrap(err, "error writing the cover file")
+	}
+	if err = tmp.Close(); err != nil {
+		return nil, errors.Wrap(err, "error closing the cover file")
+	}
+	if err = os.Rename(tmp.Name(), img.Path); err != nil {
+		return nil, errors.Wrap(err, "error moving the cover file")
+	}
+	return img, nil
+}
@@ -0,0 +1,112 @@
+package covers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testPNG(t *testing.T, width, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStore_Save(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flibusta-covers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	content := testPNG(t, 120, 180)
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	tests := []struct {
+		name    string
+		content []byte
+		want    *Image
+	}{
+		{
+			name:    "PNG",
+			content: content,
+			want: &Image{
+				Hash:     hash,
+				Path:     filepath.Join(dir, hash[0:2], hash[2:4], hash),
+				MimeType: "image/png",
+				Width:    120,
+				Height:   180,
+				Size:     len(content),
+			},
+		},
+		{
+			// повторное сохранение того же содержимого не создает новый файл
+			name:    "Same PNG",
+			content: content,
+			want: &Image{
+				Hash:     hash,
+				Path:     filepath.Join(dir, hash[0:2], hash[2:4], hash),
+				MimeType: "image/png",
+				Width:    120,
+				Height:   180,
+				Size:     len(content),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Save(tt.content)
+			if err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Save() got = %+v, want %+v", got, tt.want)
+			}
+			stored, err := ioutil.ReadFile(got.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(stored, tt.content) {
+				t.Errorf("stored content differs from the saved one")
+			}
+		})
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, hash[0:2], hash[2:4]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("files in the cover directory got = %v, want %v", len(files), 1)
+	}
+}
+
+func TestStore_Save_unknownFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flibusta-covers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Save([]byte("not an image"))
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if got.Width != 0 || got.Height != 0 {
+		t.Errorf("Save() got size = %dx%d, want 0x0", got.Width, got.Height)
+	}
+}
@@ -0,0 +1,91 @@
+package fb2
+
+import (
+	"encoding/xml"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/charset"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//Person is an author or a translator of the book
+type Person struct {
+	FirstName  string `xml:"first-name"`
+	MiddleName string `xml:"middle-name"`
+	LastName   string `xml:"last-name"`
+	Nickname   string `xml:"nickname"`
+}
+
+//Sequence is a series the book belongs to
+type Sequence struct {
+	Name   string `xml:"name,attr"`
+	Number string `xml:"number,attr"`
+}
+
+//TitleInfo is the title-info part of the book description
+type TitleInfo struct {
+	Genres      []string   `xml:"genre"`
+	Authors     []Person   `xml:"author"`
+	Translators []Person   `xml:"translator"`
+	BookTitle   string     `xml:"book-title"`
+	Annotation  annotation `xml:"annotation"`
+	Date        date       `xml:"date"`
+	Lang        string     `xml:"lang"`
+	Sequences   []Sequence `xml:"sequence"`
+}
+
+type annotation struct {
+	Content string `xml:",innerxml"`
+}
+
+type date struct {
+	Value string `xml:"value,attr"`
+	Text  string `xml:",chardata"`
+}
+
+type description struct {
+	TitleInfo TitleInfo `xml:"title-info"`
+}
+
+//AnnotationHTML returns the annotation markup without the FB2 namespace noise
+func (t *TitleInfo) AnnotationHTML() string {
+	return strings.TrimSpace(regexp.MustCompile(`\s+xmlns(:\w+)?="[^"]*"`).ReplaceAllString(t.Annotation.Content, ""))
+}
+
+//Year returns the year of the date, zero if it is unknown
+func (t *TitleInfo) Year() int {
+	for _, value := range []string{t.Date.Value, t.Date.Text} {
+		if match := regexp.MustCompile(`\d{4}`).FindString(value); match != "" {
+			year, _ := strconv.Atoi(match)
+			return year
+		}
+	}
+	return 0
+}
+
+//ReadTitleInfo reads the title-info of a FB2 file, the book body is not read
+func ReadTitleInfo(r io.Reader) (*TitleInfo, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, errors.New("error reading the fb2 file: description not found")
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading the fb2 file")
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "description" {
+			continue
+		}
+		var desc description
+		if err = decoder.DecodeElement(&desc, &start); err != nil {
+			return nil, errors.Wrap(err, "error decoding the fb2 description")
+		}
+		return &desc.TitleInfo, nil
+	}
+}
@@ -0,0 +1,60 @@
+package fb2
+
+import (
+	"log"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestReadTitleInfo(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		filename string
+	}{
+		{
+			name:     "Reading: utf-8",
+			filename: "test-books/utf8.fb2",
+		},
+		{
+			name:     "Reading: windows-1251",
+			filename: "test-books/cp1251.fb2",
+		},
+	}
+	for _, tt := range tests {
+		file, err := os.Open(tt.filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			defer file.Close()
+			got, err := ReadTitleInfo(file)
+			if err != nil {
+				t.Errorf("ReadTitleInfo() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got.BookTitle, "Путешествие Алисы") {
+				t.Errorf("ReadTitleInfo() got title = %v", got.BookTitle)
+			}
+			if !reflect.DeepEqual(got.Genres, []string{"child_sf", "sf_fantasy"}) {
+				t.Errorf("ReadTitleInfo() got genres = %v", got.Genres)
+			}
+			if !reflect.DeepEqual(got.Authors, []Person{{FirstName: "Кир", LastName: "Булычев"}}) {
+				t.Errorf("ReadTitleInfo() got authors = %v", got.Authors)
+			}
+			if !reflect.DeepEqual(got.Sequences, []Sequence{{Name: "Приключения Алисы", Number: "2"}}) {
+				t.Errorf("ReadTitleInfo() got sequences = %v", got.Sequences)
+			}
+			if got.AnnotationHTML() != "<p>Алиса с папой отправляются в космическую экспедицию.</p>" {
+				t.Errorf("ReadTitleInfo() got annotation = %v", got.AnnotationHTML())
+			}
+			if got.Year() != 1974 {
+				t.Errorf("ReadTitleInfo() got year = %v", got.Year())
+			}
+			if got.Lang != "ru" {
+				t.Errorf("ReadTitleInfo() got lang = %v", got.Lang)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package flibusta
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//Role describes how a person took part in a book
+type Role string
+
+const (
+	RoleAuthor      Role = "author"
+	RoleTranslator  Role = "translator"
+	RoleEditor      Role = "editor"
+	RoleIllustrator Role = "illustrator"
+)
+
+//contributorRoleMarkers maps the markers shown after a person link on the book page to roles
+var contributorRoleMarkers = map[string]Role{
+	"пер.":        RoleTranslator,
+	"перевод":     RoleTranslator,
+	"переводчик":  RoleTranslator,
+	"ред.":        RoleEditor,
+	"редактор":    RoleEditor,
+	"илл.":        RoleIllustrator,
+	"иллюстратор": RoleIllustrator,
+	"худ.":        RoleIllustrator,
+}
+
+//contributorRole returns the role by the text following a person link
+func contributorRole(text string) Role {
+	match := regexp.MustCompile(`^\s*\(([^)]+)\)`).FindStringSubmatch(text)
+	if match == nil {
+		return RoleAuthor
+	}
+	if role, ok := contributorRoleMarkers[strings.ToLower(strings.TrimSpace(match[1]))]; ok {
+		return role
+	}
+	return RoleAuthor
+}
+
+//AuthorProfile is the author page content
+type AuthorProfile struct {
+	ID         int
+	Name       string
+	FirstName  string
+	MiddleName string
+	LastName   string
+	Bio        string
+	Aliases    []Author
+	Books      []BibliographyEntry
+}
+
+//BibliographyEntry is a book listed on the author page
+type BibliographyEntry struct {
+	BookID      int
+	Title       string
+	Role        Role
+	SeriesID    int
+	SeriesTitle string
+}
+
+//GetAuthor fetches the author page
+func (f *Flibusta) GetAuthor(ctx context.Context, id int) (*AuthorProfile, error) {
+	content, err := f.getPage(ctx, f.url("/a/"+strconv.Itoa(id)), "author")
+	if err != nil {
+		return nil, err
+	}
+	author, err := parseAuthorPage(content)
+	if err != nil {
+		return nil, parseFailed(err)
+	}
+	author.ID = id
+	return author, nil
+}
+
+//splitAuthorName splits a full name written as "first [middle] last" into parts
+func splitAuthorName(name string) (first, middle, last string) {
+	parts := strings.Fields(name)
+	switch len(parts) {
+	case 0:
+	case 1:
+		last = parts[0]
+	case 2:
+		first, last = parts[0], parts[1]
+	default:
+		first, last = parts[0], parts[len(parts)-1]
+		middle = strings.Join(parts[1:len(parts)-1], " ")
+	}
+	return
+}
+
+//parseAuthorPage fetches the author info from a page content
+func parseAuthorPage(content string) (*AuthorProfile, error) {
+	var page AuthorProfile
+
+	// получаем имя автора
+	match := regexp.MustCompile(`<h1 class="title">(.*?)</h1>`).FindStringSubmatch(content)
+	if match == nil {
+		return nil, errors.New("error getting the author name")
+	}
+	page.Name = strings.TrimSpace(match[1])
+	page.FirstName, page.MiddleName, page.LastName = splitAuthorName(page.Name)
+
+	// получаем псевдонимы
+	page.Aliases = []Author{}
+	match = regexp.MustCompile(`(?s)Псевдонимы:(.*?)</p>`).FindStringSubmatch(content)
+	if match != nil {
+		for _, m := range regexp.MustCompile(`<a href="/a/(\d+)">(.*?)</a>`).FindAllStringSubmatch(match[1], -1) {
+			var alias Author
+			alias.ID, _ = strconv.Atoi(m[1])
+			alias.Name = strings.TrimSpace(m[2])
+			page.Aliases = append(page.Aliases, alias)
+		}
+	}
+
+	// получаем биографию. ищем от заголовка до списка книг
+	match = regexp.MustCompile(`(?s)<h2>Об авторе</h2>(.*?)<form`).FindStringSubmatch(content)
+	if match != nil {
+		page.Bio = strings.TrimSpace(match[1])
+	}
+
+	// получаем список книг. заголовки разделов меняют роль, ссылки на сериалы и подзаголовки меняют серию
+	page.Books = []BibliographyEntry{}
+	match = regexp.MustCompile(`(?s)<form method="POST" action="/mass/download">(.*?)</form>`).FindStringSubmatch(content)
+	if match == nil {
+		return &page, nil
+	}
+	role := RoleAuthor
+	var seriesID int
+	var seriesTitle string
+	tokenPattern := regexp.MustCompile(`<h3>(.*?)</h3>|<h4>(.*?)</h4>|<a href="/s/(\d+)">(.*?)</a>|<a href="/b/(\d+)">(.*?)</a>`)
+	for _, m := range tokenPattern.FindAllStringSubmatch(match[1], -1) {
+		switch {
+		case m[1] != "":
+			role = RoleAuthor
+			if strings.Contains(m[1], "Переводы") {
+				role = RoleTranslator
+			}
+			seriesID, seriesTitle = 0, ""
+		case m[2] != "":
+			seriesID, seriesTitle = 0, ""
+		case m[3] != "":
+			seriesID, _ = strconv.Atoi(m[3])
+			seriesTitle = strings.TrimSpace(m[4])
+		case m[5] != "":
+			entry := BibliographyEntry{
+				Title:       strings.TrimSpace(m[6]),
+				Role:        role,
+				SeriesID:    seriesID,
+				SeriesTitle: seriesTitle,
+			}
+			entry.BookID, _ = strconv.Atoi(m[5])
+			page.Books = append(page.Books, entry)
+		}
+	}
+
+	return &page, nil
+}
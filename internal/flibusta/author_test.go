@@ -0,0 +1,102 @@
+package flibusta
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func Test_parseAuthorPage(t *testing.T) {
+	t.Parallel()
+	content, err := ioutil.ReadFile("test-pages/author-sample.html")
+	if err != nil {
+		log.Fatal(err)
+	}
+	want := &AuthorProfile{
+		Name:      "Кир Булычев",
+		FirstName: "Кир",
+		LastName:  "Булычев",
+		Bio: `<p>Советский писатель-фантаст, историк-востоковед, сценарист.</p>
+        <p>Автор цикла книг о девочке из будущего Алисе Селезнёвой.</p>`,
+		Aliases: []Author{
+			{
+				ID:   1001,
+				Name: "Игорь Всеволодович Можейко",
+			},
+			{
+				ID:   1002,
+				Name: "Кирилл Булычев",
+			},
+		},
+		Books: []BibliographyEntry{
+			{
+				BookID:      3001,
+				Title:       "Девочка, с которой ничего не случится",
+				Role:        RoleAuthor,
+				SeriesID:    2001,
+				SeriesTitle: "Приключения Алисы",
+			},
+			{
+				BookID:      3002,
+				Title:       "Путешествие Алисы",
+				Role:        RoleAuthor,
+				SeriesID:    2001,
+				SeriesTitle: "Приключения Алисы",
+			},
+			{
+				BookID: 3003,
+				Title:  "Марсианское зелье",
+				Role:   RoleAuthor,
+			},
+			{
+				BookID: 3004,
+				Title:  "Сказки народов Бирмы",
+				Role:   RoleTranslator,
+			},
+		},
+	}
+	t.Run("Parsing: Кир Булычев", func(t *testing.T) {
+		got, err := parseAuthorPage(string(content))
+		if err != nil {
+			t.Errorf("parseAuthorPage() error = %v", err)
+			return
+		}
+		if !reflect.DeepEqual(got.Name, want.Name) {
+			t.Errorf("parseAuthorPage() got name = %v, want name %v", got.Name, want.Name)
+		}
+		if got.FirstName != want.FirstName || got.MiddleName != want.MiddleName || got.LastName != want.LastName {
+			t.Errorf("parseAuthorPage() got name parts = %v %v %v, want name parts %v %v %v",
+				got.FirstName, got.MiddleName, got.LastName, want.FirstName, want.MiddleName, want.LastName)
+		}
+		if !reflect.DeepEqual(got.Bio, want.Bio) {
+			t.Errorf("parseAuthorPage() got bio = %v, want bio %v", got.Bio, want.Bio)
+		}
+		if !reflect.DeepEqual(got.Aliases, want.Aliases) {
+			t.Errorf("parseAuthorPage() got aliases = %v, want aliases %v", got.Aliases, want.Aliases)
+		}
+		if !reflect.DeepEqual(got.Books, want.Books) {
+			t.Errorf("parseAuthorPage() got books = %v, want books %v", got.Books, want.Books)
+		}
+	})
+}
+
+func Test_splitAuthorName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name                string
+		first, middle, last string
+	}{
+		{name: "Аарон", last: "Аарон"},
+		{name: "Джейсон Грегори", first: "Джейсон", last: "Грегори"},
+		{name: "Игорь Всеволодович Можейко", first: "Игорь", middle: "Всеволодович", last: "Можейко"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, middle, last := splitAuthorName(tt.name)
+			if first != tt.first || middle != tt.middle || last != tt.last {
+				t.Errorf("splitAuthorName() got = %v %v %v, want %v %v %v", first, middle, last, tt.first, tt.middle, tt.last)
+			}
+		})
+	}
+}
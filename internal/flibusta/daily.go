@@ -0,0 +1,33 @@
+package flibusta
+
+import (
+	"context"
+	"io"
+	"regexp"
+)
+
+//GetDailyArchives lists the archive names published on the daily updates page
+func (f *Flibusta) GetDailyArchives(ctx context.Context) ([]string, error) {
+	content, err := f.getPage(ctx, f.url("/daily/"), "daily updates")
+	if err != nil {
+		return nil, err
+	}
+	return parseDailyIndex(content), nil
+}
+
+//DownloadDailyArchive writes the daily archive content to w
+func (f *Flibusta) DownloadDailyArchive(ctx context.Context, name string, w io.Writer) error {
+	return f.getContent(ctx, f.url("/daily/"+name), "daily archive "+name, func(body io.Reader) error {
+		_, err := io.Copy(w, body)
+		return err
+	})
+}
+
+//parseDailyIndex fetches the fb2 archive names from the daily updates page content
+func parseDailyIndex(content string) []string {
+	names := []string{}
+	for _, m := range regexp.MustCompile(`<a href="([^"/?]+\.fb2\.[^"/?]+\.zip)">`).FindAllStringSubmatch(content, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
@@ -0,0 +1,154 @@
+package flibusta
+
+import (
+	"archive/zip"
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+//DownloadFormats lists the formats the site converts books to, an empty format means the original file
+var DownloadFormats = []string{"fb2", "html", "txt", "rtf", "epub", "mobi"}
+
+//BookFile is a downloaded book file, the caller must close the body
+type BookFile struct {
+	Name string
+	Body io.ReadCloser
+}
+
+//DownloadBook streams the book file in the format. Flibusta wraps fb2 files in a zip, they are unpacked.
+func (f *Flibusta) DownloadBook(ctx context.Context, id int, format string) (*BookFile, error) {
+	var file *BookFile
+	err := f.withSession(func() (err error) {
+		file, err = f.downloadBook(ctx, id, format)
+		return err
+	})
+	return file, err
+}
+
+func (f *Flibusta) downloadBook(ctx context.Context, id int, format string) (*BookFile, error) {
+	link := f.url("/b/" + strconv.Itoa(id) + "/download")
+	if format != "" {
+		if !isDownloadFormat(format) {
+			return nil, errors.Errorf("error downloading the book: unknown format %s", format)
+		}
+		link = f.url("/b/" + strconv.Itoa(id) + "/" + format)
+	}
+	resp, err := f.getFollowingRedirects(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	if err = classifyResponse(resp, "book file"); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	file := &BookFile{Name: downloadFileName(resp), Body: resp.Body}
+	if !strings.HasSuffix(strings.ToLower(file.Name), ".zip") {
+		return file, nil
+	}
+	return unzipBookFile(file)
+}
+
+func isDownloadFormat(format string) bool {
+	for _, f := range DownloadFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+//getFollowingRedirects follows the download redirects the client does not follow by itself
+func (f *Flibusta) getFollowingRedirects(ctx context.Context, link string) (*http.Response, error) {
+	for i := 0; i < 5; i++ {
+		resp, err := f.get(ctx, link)
+		if err != nil {
+			return nil, classified(ErrTransient, 0, errors.Wrap(err, "error downloading the book"))
+		}
+		location := resp.Header.Get("Location")
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 || location == "" {
+			return resp, nil
+		}
+		resp.Body.Close()
+		next, err := resp.Request.URL.Parse(location)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing the redirect location")
+		}
+		if strings.Contains(next.Path, "/user/login") || strings.Contains(next.RawQuery, "destination=") {
+			return nil, classified(ErrAuthRequired, resp.StatusCode, errors.New("error downloading the book: the request was redirected to the login page"))
+		}
+		link = next.String()
+	}
+	return nil, errors.New("error downloading the book: too many redirects")
+}
+
+//downloadFileName returns the file name from the Content-Disposition header or the URL
+func downloadFileName(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+	return path.Base(resp.Request.URL.Path)
+}
+
+//unzipBookFile replaces the zip archive with its first file. The archive is spooled to a temporary file
+//removed when the body is closed, so the book is not held in memory.
+func unzipBookFile(file *BookFile) (*BookFile, error) {
+	defer file.Body.Close()
+	spool, err := ioutil.TempFile("", "flibusta-book-*.zip")
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating the book archive file")
+	}
+	_, err = io.Copy(spool, file.Body)
+	if closeErr := spool.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(spool.Name())
+		return nil, errors.Wrap(err, "error reading the book archive")
+	}
+	archive, err := zip.OpenReader(spool.Name())
+	if err != nil {
+		os.Remove(spool.Name())
+		return nil, errors.Wrap(err, "error opening the book archive")
+	}
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		body, err := entry.Open()
+		if err != nil {
+			archive.Close()
+			os.Remove(spool.Name())
+			return nil, errors.Wrap(err, "error opening the book file in the archive")
+		}
+		return &BookFile{Name: path.Base(entry.Name), Body: &archivedFile{ReadCloser: body, archive: archive, spool: spool.Name()}}, nil
+	}
+	archive.Close()
+	os.Remove(spool.Name())
+	return nil, errors.New("error opening the book archive: the archive is empty")
+}
+
+//archivedFile is a file in the spooled archive, closing it closes the archive and removes the spool
+type archivedFile struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+	spool   string
+}
+
+func (f *archivedFile) Close() error {
+	err := f.ReadCloser.Close()
+	if closeErr := f.archive.Close(); err == nil {
+		err = closeErr
+	}
+	if removeErr := os.Remove(f.spool); err == nil {
+		err = removeErr
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package flibusta
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func Test_unzipBookFile(t *testing.T) {
+	t.Parallel()
+	var archive bytes.Buffer
+	w := zip.NewWriter(&archive)
+	entry, err := w.Create("Bulychev_Puteshestvie-Alisy.fb2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = entry.Write([]byte("<FictionBook/>"))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("Unpacking fb2", func(t *testing.T) {
+		got, err := unzipBookFile(&BookFile{Name: "Bulychev_Puteshestvie-Alisy.fb2.zip", Body: ioutil.NopCloser(&archive)})
+		if err != nil {
+			t.Errorf("unzipBookFile() error = %v", err)
+			return
+		}
+		if got.Name != "Bulychev_Puteshestvie-Alisy.fb2" {
+			t.Errorf("unzipBookFile() got name = %v, want name %v", got.Name, "Bulychev_Puteshestvie-Alisy.fb2")
+		}
+		content, _ := ioutil.ReadAll(got.Body)
+		if string(content) != "<FictionBook/>" {
+			t.Errorf("unzipBookFile() got content = %v, want content %v", string(content), "<FictionBook/>")
+		}
+		// временный файл архива удаляется вместе с закрытием книги
+		spool := got.Body.(*archivedFile).spool
+		if err = got.Body.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+		if _, err = os.Stat(spool); !os.IsNotExist(err) {
+			t.Errorf("unzipBookFile() left the archive file %v, stat error = %v", spool, err)
+		}
+	})
+
+	t.Run("Empty archive", func(t *testing.T) {
+		var empty bytes.Buffer
+		if err := zip.NewWriter(&empty).Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := unzipBookFile(&BookFile{Name: "empty.zip", Body: ioutil.NopCloser(&empty)}); err == nil {
+			t.Errorf("unzipBookFile() error = %v, wantErr %v", err, true)
+		}
+	})
+}
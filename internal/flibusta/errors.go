@@ -0,0 +1,168 @@
+package flibusta
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+//ErrorClass tells why a page could not be fetched
+type ErrorClass string
+
+const (
+	ErrNotFound     ErrorClass = "not_found"
+	ErrAuthRequired ErrorClass = "auth_required"
+	ErrBlocked      ErrorClass = "blocked"
+	ErrRateLimited  ErrorClass = "rate_limited"
+	ErrTransient    ErrorClass = "transient"
+	ErrParseFailure ErrorClass = "parse_failure"
+	ErrUnclassified ErrorClass = "unclassified"
+)
+
+//Error is a classified error of the client
+type Error struct {
+	Class ErrorClass
+	//StatusCode is the HTTP status of the response, zero if there was none
+	StatusCode int
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+//Retryable reports whether the same request may succeed later
+func (e *Error) Retryable() bool {
+	return e.Class == ErrTransient || e.Class == ErrRateLimited
+}
+
+func classified(class ErrorClass, statusCode int, err error) *Error {
+	return &Error{Class: class, StatusCode: statusCode, Err: err}
+}
+
+//ClassOf returns the class of the error, ErrUnclassified for the errors not made by the client
+func ClassOf(err error) ErrorClass {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Class
+	}
+	return ErrUnclassified
+}
+
+//StatusCodeOf returns the HTTP status of the failed response, zero if it is unknown
+func StatusCodeOf(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+//IsRetryable reports whether the error is a transient one
+func IsRetryable(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Retryable()
+}
+
+//classifyResponse returns an error for the responses without the page content
+func classifyResponse(resp *http.Response, what string) error {
+	code := resp.StatusCode
+	switch {
+	case code == http.StatusOK:
+		return nil
+	case code >= 300 && code < 400:
+		// неавторизованных пользователей сайт отправляет на страницу входа
+		location := resp.Header.Get("Location")
+		if strings.Contains(location, "/user/login") || strings.Contains(location, "destination=") {
+			return classified(ErrAuthRequired, code, errors.Errorf("error getting the %s content: the request was redirected to the login page", what))
+		}
+		return classified(ErrNotFound, code, errors.Errorf("error getting the %s content: the request was redirected to %s", what, location))
+	case code == http.StatusNotFound || code == http.StatusGone:
+		return classified(ErrNotFound, code, errors.Errorf("error getting the %s content: not found", what))
+	case code == http.StatusUnauthorized:
+		return classified(ErrAuthRequired, code, errors.Errorf("error getting the %s content: authorization required", what))
+	case code == http.StatusForbidden || code == http.StatusUnavailableForLegalReasons:
+		return classified(ErrBlocked, code, errors.Errorf("error getting the %s content: access is blocked", what))
+	case code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable:
+		return classified(ErrRateLimited, code, errors.Errorf("error getting the %s content: http status code is %d", what, code))
+	case code >= 500:
+		return classified(ErrTransient, code, errors.Errorf("error getting the %s content: http status code is %d", what, code))
+	}
+	return classified(ErrUnclassified, code, errors.Errorf("error getting the %s content: http status code is %d", what, code))
+}
+
+//get sends a GET request canceled with the context
+func (f *Flibusta) get(ctx context.Context, link string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f.client.Do(req)
+}
+
+//getPage fetches the page content and classifies the failures, an expired session is restored
+func (f *Flibusta) getPage(ctx context.Context, link, what string) (string, error) {
+	var content string
+	err := f.withSession(func() (err error) {
+		content, err = f.fetchPage(ctx, link, what)
+		return err
+	})
+	return content, err
+}
+
+func (f *Flibusta) fetchPage(ctx context.Context, link, what string) (string, error) {
+	resp, err := f.get(ctx, link)
+	if err != nil {
+		return "", classified(ErrTransient, 0, errors.Wrapf(err, "error getting the %s content", what))
+	}
+	defer resp.Body.Close()
+	if err = classifyResponse(resp, what); err != nil {
+		return "", err
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", classified(ErrTransient, resp.StatusCode, errors.Wrapf(err, "error reading the %s content", what))
+	}
+	// истекшая сессия выглядит как обычная страница с формой входа
+	if f.sessionID() > 0 && isGuestPage(string(content)) {
+		return "", classified(ErrAuthRequired, resp.StatusCode, errors.Errorf("error getting the %s content: the session has expired", what))
+	}
+	return string(content), nil
+}
+
+//getContent fetches the content and passes the body of the successful response to read. The failures
+//are classified and an expired session is restored, the redirects to the login page come before any reading.
+func (f *Flibusta) getContent(ctx context.Context, link, what string, read func(body io.Reader) error) error {
+	return f.withSession(func() error {
+		resp, err := f.get(ctx, link)
+		if err != nil {
+			return classified(ErrTransient, 0, errors.Wrapf(err, "error getting the %s content", what))
+		}
+		defer resp.Body.Close()
+		if err = classifyResponse(resp, what); err != nil {
+			return err
+		}
+		if err = read(resp.Body); err != nil {
+			return classified(ErrTransient, resp.StatusCode, errors.Wrapf(err, "error reading the %s content", what))
+		}
+		return nil
+	})
+}
+
+//parseFailed marks the error of a page parser
+func parseFailed(err error) error {
+	if err == nil {
+		return nil
+	}
+	return classified(ErrParseFailure, http.StatusOK, err)
+}
@@ -0,0 +1,45 @@
+package flibusta
+
+import (
+	"net/http"
+	"testing"
+)
+
+func Test_classifyResponse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		status    int
+		location  string
+		want      ErrorClass
+		retryable bool
+	}{
+		{name: "Login redirect", status: 302, location: "https://flibusta.is/user/login?destination=b/1", want: ErrAuthRequired},
+		{name: "Other redirect", status: 302, location: "https://flibusta.is/", want: ErrNotFound},
+		{name: "Not found", status: 404, want: ErrNotFound},
+		{name: "Blocked", status: 403, want: ErrBlocked},
+		{name: "Rate limited", status: 429, want: ErrRateLimited, retryable: true},
+		{name: "Server error", status: 502, want: ErrTransient, retryable: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			resp.Header.Set("Location", tt.location)
+			err := classifyResponse(resp, "book")
+			if got := ClassOf(err); got != tt.want {
+				t.Errorf("classifyResponse() got class = %v, want class %v", got, tt.want)
+			}
+			if got := IsRetryable(err); got != tt.retryable {
+				t.Errorf("classifyResponse() got retryable = %v, want retryable %v", got, tt.retryable)
+			}
+			if got := StatusCodeOf(err); got != tt.status {
+				t.Errorf("classifyResponse() got status = %v, want status %v", got, tt.status)
+			}
+		})
+	}
+	if err := classifyResponse(&http.Response{StatusCode: 200}, "book"); err != nil {
+		t.Errorf("classifyResponse() error = %v, want nil", err)
+	}
+}
@@ -1,79 +1,208 @@
 package flibusta
 
 import (
-	"bytes"
+	"context"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/pkg/errors"
+	"golang.org/x/net/html"
 	"golang.org/x/net/publicsuffix"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Book struct {
-	ID         int
-	Title      string
-	ReadCount  int
-	Authors    []Author
-	Annotation string
-	Genres     []Genre
+	ID                  int
+	Title               string
+	ReadCount           int
+	RecommendationCount int
+	FileRating          int
+	Contributors        []Contributor
+	Annotation          string
+	Genres              []Genre
+	Format              string
+	Size                int64
+	Pages               int
+	Year                int
+	Added               time.Time
+	Status              Status
+	ReplacedBy          int
+	Cover               string
+	Series              []SeriesMembership
+	Reviews             []Review
 }
 
+//Status describes availability of a book in the library
+type Status string
+
+const (
+	StatusActive   Status = "active"
+	StatusDeleted  Status = "deleted"
+	StatusBlocked  Status = "blocked"
+	StatusReplaced Status = "replaced"
+)
+
 type Author struct {
 	ID   int
 	Name string
 }
 
-type Genre struct {
+//Contributor is a person credited on the book page
+type Contributor struct {
 	ID   int
 	Name string
+	Role Role
+}
+
+type Genre struct {
+	ID    int
+	Name  string
+	Code  string
+	Group string
 }
 
 type Client interface {
-	GetBook(int) (*Book, error)
+	GetBook(ctx context.Context, id int) (*Book, error)
+	GetCover(ctx context.Context, path string) ([]byte, error)
+	GetAuthor(ctx context.Context, id int) (*AuthorProfile, error)
+	GetSeries(ctx context.Context, id int) (*Series, error)
+	GetLatestBookID(ctx context.Context) (int, error)
+	GetDailyArchives(ctx context.Context) ([]string, error)
+	DownloadDailyArchive(ctx context.Context, name string, w io.Writer) error
+	DownloadBook(ctx context.Context, id int, format string) (*BookFile, error)
 	Auth(username, password string) error
 }
 
 type Flibusta struct {
-	client *http.Client
+	client     *http.Client
+	baseURL    *url.URL
+	cookieFile string
+	// authMu не дает воркерам входить на сайт одновременно
+	authMu   sync.Mutex
+	username string
+	password string
+	// session растет с каждым входом, по нему видно, что сессию уже обновил другой воркер
+	session int
 }
 
-//NewClient creates new http client
-func NewClient() (*http.Client, error) {
+//Options configures the flibusta client
+type Options struct {
+	RateLimit RateLimit
+	//CookieFile keeps the session cookies between runs, empty disables it
+	CookieFile string
+	//BaseURL is the site address, DefaultBaseURL if empty
+	BaseURL string
+	//Mirrors are tried in order when the site can not be reached
+	Mirrors []string
+	//Proxy is an http, https or socks5 proxy URL, empty uses the proxy from the environment
+	Proxy string
+	//UserAgent is DefaultUserAgent if empty
+	UserAgent string
+	//Timeout limits a whole request including reading the body, zero means no limit
+	Timeout time.Duration
+	//ConnectTimeout limits connecting to the site or the proxy
+	ConnectTimeout time.Duration
+}
+
+//NewClient creates new http client throttled by the rate limit
+func NewClient(opts Options) (*http.Client, error) {
 	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating the http client")
 	}
+	base, err := parseSiteURL(opts.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	var mirrors []*url.URL
+	for _, mirror := range opts.Mirrors {
+		mirrorURL, err := parseSiteURL(mirror)
+		if err != nil {
+			return nil, err
+		}
+		mirrors = append(mirrors, mirrorURL)
+	}
+	transport, err := newTransport(opts.Proxy, opts.ConnectTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating the http client")
+	}
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
 	client := &http.Client{
 		// Prevent redirects
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
-		Jar: jar,
+		Jar:       jar,
+		Transport: newRateLimitedTransport(newMirrorTransport(transport, base, mirrors, userAgent), opts.RateLimit),
+		Timeout:   opts.Timeout,
 	}
 	return client, nil
 }
 
+//parseSiteURL parses the site address, an empty one is DefaultBaseURL
+func parseSiteURL(address string) (*url.URL, error) {
+	if address == "" {
+		address = DefaultBaseURL
+	}
+	siteURL, err := url.Parse(strings.TrimRight(address, "/"))
+	if err != nil || siteURL.Host == "" || (siteURL.Scheme != "http" && siteURL.Scheme != "https") {
+		return nil, errors.Errorf("error parsing the site address %s", address)
+	}
+	return siteURL, nil
+}
+
 //NewFlibusta creates new flibusta client
-func NewFlibusta() (Client, error) {
-	client, err := NewClient()
+func NewFlibusta(opts Options) (Client, error) {
+	client, err := NewClient(opts)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating the flibusta client")
 	}
-	return &Flibusta{client: client}, nil
+	base, err := parseSiteURL(opts.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Flibusta{client: client, baseURL: base, cookieFile: opts.CookieFile}, nil
+}
+
+//url returns the absolute address of the site path
+func (f *Flibusta) url(path string) string {
+	return f.baseURL.String() + path
 }
 
-//Auth authorizes a client
+//Auth authorizes a client, the session saved in the cookie file is reused if it is still valid.
+//The credentials are kept to log in again once the session expires.
 func (f *Flibusta) Auth(username, password string) error {
 	if len(username) == 0 || len(password) == 0 {
 		return errors.New("the username and the password must be set")
 	}
-	res, err := f.client.Get("https://flibusta.is")
+	f.authMu.Lock()
+	defer f.authMu.Unlock()
+	f.username, f.password = username, password
+	if f.cookieFile != "" {
+		loaded, err := f.loadCookies()
+		if err != nil {
+			return err
+		}
+		if loaded && f.checkSession() == nil {
+			f.session++
+			return nil
+		}
+	}
+	return f.login()
+}
+
+//login submits the login form, it must be called with authMu held
+func (f *Flibusta) login() error {
+	res, err := f.client.Get(f.url("/"))
 	if err != nil {
 		return errors.Wrap(err, "error getting unauthorized page")
 	}
@@ -82,16 +211,15 @@ func (f *Flibusta) Auth(username, password string) error {
 	if err != nil {
 		return errors.Wrap(err, "error getting the auth params")
 	}
-	params.data.Add("name", username)
-	params.data.Add("pass", password)
-	req, err := http.NewRequest(http.MethodPost, "https://flibusta.is"+params.loginUrl, strings.NewReader(params.data.Encode()))
+	params.data.Add("name", f.username)
+	params.data.Add("pass", f.password)
+	req, err := http.NewRequest(http.MethodPost, f.url(params.loginUrl), strings.NewReader(params.data.Encode()))
 	if err != nil {
 		return errors.Wrap(err, "error making preparing an auth request")
 	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("Origin", "https://flibusta.is")
-	req.Header.Add("Referer", "https://flibusta.is/")
-	req.Header.Add("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/89.0.4389.82 Safari/537.36")
+	req.Header.Add("Origin", f.url(""))
+	req.Header.Add("Referer", f.url("/"))
 	res, err = f.client.Do(req)
 	if err != nil {
 		return errors.Wrap(err, "error making an auth request")
@@ -100,34 +228,47 @@ func (f *Flibusta) Auth(username, password string) error {
 	if res.StatusCode != 302 {
 		return errors.Errorf("error doing an auth request: http status code is %d", res.StatusCode)
 	}
-	res, err = f.client.Get(res.Header.Get("Location"))
-	if err != nil {
-		return errors.Wrap(err, "error checking for authorization status")
+	if err = f.checkSession(); err != nil {
+		return errors.Wrap(err, "error checking if auth was success")
 	}
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return errors.New("error reading authorized page response body")
-	}
-	if !bytes.Contains(body, []byte(params.data.Get("user"))) {
-		return errors.New("error checking if auth was success")
+	f.session++
+	if f.cookieFile != "" {
+		return f.saveCookies()
 	}
 	return nil
 }
 
-func (f *Flibusta) GetBook(id int) (*Book, error) {
-	resp, err := f.client.Get("https://flibusta.is/b/" + strconv.Itoa(id))
+//GetBook fetches the book page, the errors are classified with the *Error type
+func (f *Flibusta) GetBook(ctx context.Context, id int) (*Book, error) {
+	content, err := f.getPage(ctx, f.url("/b/"+strconv.Itoa(id)), "book")
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return nil, errors.New("error getting the book content: the request was redirected")
+	book, err := parsePageContent(content)
+	if err != nil {
+		return nil, parseFailed(err)
 	}
-	content, err := io.ReadAll(resp.Body)
+	return book, nil
+}
+
+//GetLatestBookID returns the highest book ID listed on the new arrivals page
+func (f *Flibusta) GetLatestBookID(ctx context.Context) (int, error) {
+	content, err := f.getPage(ctx, f.url("/new"), "new arrivals")
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	return parsePageContent(string(content))
+	id, err := parseNewPage(content)
+	return id, parseFailed(err)
+}
+
+//GetCover downloads a book cover image by its path on the site
+func (f *Flibusta) GetCover(ctx context.Context, path string) ([]byte, error) {
+	var content []byte
+	err := f.getContent(ctx, f.url(path), "cover", func(body io.Reader) (err error) {
+		content, err = io.ReadAll(body)
+		return err
+	})
+	return content, err
 }
 
 //parsePageContent fetches the book info from a page content
@@ -159,6 +300,58 @@ func parsePageContent(content string) (*Book, error) {
 		return nil, errors.Wrap(err, "error converting the book ID to an int")
 	}
 
+	// получаем формат файла из заголовка страницы
+	match = regexp.MustCompile(`<h1 class="title">.*\((\w+)\)</h1>`).FindStringSubmatch(content)
+	if match != nil {
+		page.Format = match[1]
+	}
+
+	// получаем размер файла в байтах и количество страниц
+	match = regexp.MustCompile(`<span style=size>(\d+)K(?:, (\d+) с\.)?</span>`).FindStringSubmatch(content)
+	if match != nil {
+		size, _ := strconv.ParseInt(match[1], 10, 64)
+		page.Size = size * 1024
+		if match[2] != "" {
+			page.Pages, _ = strconv.Atoi(match[2])
+		}
+	}
+
+	// получаем год издания
+	match = regexp.MustCompile(`издание (\d{4}) г\.`).FindStringSubmatch(content)
+	if match != nil {
+		page.Year, _ = strconv.Atoi(match[1])
+	}
+
+	// получаем дату добавления книги в библиотеку
+	match = regexp.MustCompile(`Добавлена: (\d{2}\.\d{2}\.\d{4})`).FindStringSubmatch(content)
+	if match != nil {
+		page.Added, err = time.Parse("02.01.2006", match[1])
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing the book added date")
+		}
+	}
+
+	// определяем статус книги. замененная книга может быть одновременно удалена, но важнее ссылка на замену
+	page.Status = StatusActive
+	match = regexp.MustCompile(`заменена на <a href="/b/(\d+)">`).FindStringSubmatch(content)
+	if match != nil {
+		page.Status = StatusReplaced
+		page.ReplacedBy, _ = strconv.Atoi(match[1])
+	} else if strings.Contains(content, "(книга удалена из библиотеки)") {
+		page.Status = StatusDeleted
+	} else if strings.Contains(content, `src="/img/zamok.gif"`) {
+		page.Status = StatusBlocked
+	}
+
+	// получаем путь к обложке
+	match = regexp.MustCompile(`<img src="([^"]+)" alt="Cover image"`).FindStringSubmatch(content)
+	if match != nil {
+		page.Cover = match[1]
+	}
+
+	// получаем сериалы, в которые входит книга
+	page.Series = parseBookSeries(content)
+
 	spaceAndLineEndPattern := regexp.MustCompile(`\s{2,}|\n`)
 
 	match = regexp.MustCompile(`книга прочитана (\d+)`).FindStringSubmatch(content)
@@ -166,17 +359,35 @@ func parsePageContent(content string) (*Book, error) {
 		page.ReadCount, _ = strconv.Atoi(match[1])
 	}
 
-	// получаем список авторов. ищем все ссылки на авторов после тега скрипт вначале страницы
-	page.Authors = []Author{}
+	// получаем число рекомендаций пользователей
+	match = regexp.MustCompile(`рекомендовали (\d+) пользовател`).FindStringSubmatch(content)
+	if match != nil {
+		page.RecommendationCount, _ = strconv.Atoi(match[1])
+	}
+
+	// получаем оценку файла от 1 до 5, у неоцененного файла оценка 0.
+	// оценка показывается значком znak1.gif - znak5.gif, значок znak.gif означает "файл не оценен"
+	match = regexp.MustCompile(`src="/img/znak(\d)\.gif"`).FindStringSubmatch(content)
+	if match != nil {
+		page.FileRating, _ = strconv.Atoi(match[1])
+	}
+
+	// получаем список авторов. ищем все ссылки на авторов после тега скрипт вначале страницы.
+	// роль указана в скобках после ссылки, например "(пер.)", без пометки это автор
+	page.Contributors = []Contributor{}
 	doc.Find("script~a[href*='/a/']").Each(func(i int, selection *goquery.Selection) {
-		var author Author
+		var author Contributor
 		author.Name = spaceAndLineEndPattern.ReplaceAllString(selection.Text(), " ")
 		match = regexp.MustCompile(`/a/(\d+)`).FindStringSubmatch(selection.AttrOr("href", ""))
 		if match == nil {
 			return
 		}
 		author.ID, _ = strconv.Atoi(match[1])
-		page.Authors = append(page.Authors, author)
+		author.Role = RoleAuthor
+		if next := selection.Nodes[0].NextSibling; next != nil && next.Type == html.TextNode {
+			author.Role = contributorRole(next.Data)
+		}
+		page.Contributors = append(page.Contributors, author)
 	})
 
 	// получаем аннотацию. ищем от заголовка до ближайшей ссылки, либо линии-разделителя
@@ -192,6 +403,9 @@ func parsePageContent(content string) (*Book, error) {
 		page.Annotation = strings.TrimSpace(match[1])
 	}
 
+	// получаем впечатления пользователей о книге
+	page.Reviews = parseReviews(content)
+
 	// получаем список жанров
 	doc.Find("a.genre").Each(func(i int, selection *goquery.Selection) {
 		var genre Genre
@@ -201,6 +415,8 @@ func parsePageContent(content string) (*Book, error) {
 			return
 		}
 		genre.ID, _ = strconv.Atoi(match[1])
+		genre.Code = selection.AttrOr("name", "")
+		genre.Group = genreGroupOfPage(selection.Closest("div").AttrOr("class", ""), genre.Code)
 		page.Genres = append(page.Genres, genre)
 	})
 
@@ -208,6 +424,21 @@ func parsePageContent(content string) (*Book, error) {
 	return &page, nil
 }
 
+//parseNewPage fetches the highest book ID from the new arrivals page content
+func parseNewPage(content string) (int, error) {
+	var latest int
+	for _, m := range regexp.MustCompile(`<a href="/b/(\d+)">`).FindAllStringSubmatch(content, -1) {
+		id, _ := strconv.Atoi(m[1])
+		if id > latest {
+			latest = id
+		}
+	}
+	if latest == 0 {
+		return 0, errors.New("error getting the latest book ID")
+	}
+	return latest, nil
+}
+
 //authParams authorization page data
 type authParams struct {
 	loginUrl string
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_parseAuthPage(t *testing.T) {
@@ -51,24 +52,34 @@ func Test_parsePageContent(t *testing.T) {
 			name:     "Parsing: Внетелесный опыт",
 			filename: "test-pages/book-9.html",
 			want: &Book{
-				ID:        9,
-				ReadCount: 704,
-				Title:     "Внетелесный опыт",
-				Authors: []Author{
+				ID:         9,
+				ReadCount:  704,
+				Title:      "Внетелесный опыт",
+				Format:     "fb2",
+				Size:       69 * 1024,
+				Added:      time.Date(2007, 6, 20, 0, 0, 0, 0, time.UTC),
+				Status:     StatusReplaced,
+				ReplacedBy: 114062,
+				Series:     []SeriesMembership{},
+				Contributors: []Contributor{
 					{
 						ID:   24445,
 						Name: "Аарон",
+						Role: RoleAuthor,
 					},
 					{
 						ID:   32193,
 						Name: "Сентхил Кумар",
+						Role: RoleAuthor,
 					},
 				},
 				Annotation: `отсутствует`,
 				Genres: []Genre{
 					{
-						ID:   97,
-						Name: "Религия, религиозная литература",
+						ID:    97,
+						Name:  "Религия, религиозная литература",
+						Code:  "religion",
+						Group: "religion",
 					},
 				},
 			},
@@ -80,22 +91,35 @@ func Test_parsePageContent(t *testing.T) {
 				ID:        611196,
 				ReadCount: 288,
 				Title:     "Игровой движок [Программирование и внутреннее устройство]",
-				Authors: []Author{
+				Format:    "pdf",
+				Size:      24723 * 1024,
+				Pages:     1136,
+				Year:      2021,
+				Added:     time.Date(2021, 2, 19, 0, 0, 0, 0, time.UTC),
+				Status:    StatusBlocked,
+				Cover:     "/ib/55/494655/cover_1.jpg",
+				Series:    []SeriesMembership{},
+				Contributors: []Contributor{
 					{
 						ID:   237578,
 						Name: "Джейсон Грегори",
+						Role: RoleAuthor,
 					},
 				},
 				Annotation: `<p>Книга Джейсона Грегори не случайно является бестселлером. Двадцать лет работы автора над первоклассными играми в Midway, Electronic Arts и Naughty Dog позволяют поделиться знаниями о теории и практике разработки ПО для игрового движка. Игровое программирование — сложная и огромная тема, охватывающая множество вопросов.<br />
                     Граница между игровым движком и игрой размыта. В этой книге основное внимание уделено движку, основным низкоуровневым системам, системам разрешения коллизий, симуляции физики, анимации персонажей, аудио, а также базовому слою геймплея, включающему объектную модель игры, редактор мира, системы событий и скриптинга</p>`,
 				Genres: []Genre{
 					{
-						ID:   83,
-						Name: "Зарубежная компьютерная, околокомпьютерная литература",
+						ID:    83,
+						Name:  "Зарубежная компьютерная, околокомпьютерная литература",
+						Code:  "computers",
+						Group: "computers",
 					},
 					{
-						ID:   81,
-						Name: "Программирование, программы, базы данных",
+						ID:    81,
+						Name:  "Программирование, программы, базы данных",
+						Code:  "comp_db",
+						Group: "computers",
 					},
 				},
 			},
@@ -107,14 +131,24 @@ func Test_parsePageContent(t *testing.T) {
 				ID:        235391,
 				ReadCount: 83,
 				Title:     "Design Driven Testing: Test Smarter, Not Harder",
-				Authors: []Author{
+				Format:    "pdf",
+				Size:      12823 * 1024,
+				Pages:     365,
+				Year:      2010,
+				Added:     time.Date(2011, 7, 4, 0, 0, 0, 0, time.UTC),
+				Status:    StatusActive,
+				Cover:     "/ib/83/109683/desdrte.jpeg",
+				Series:    []SeriesMembership{},
+				Contributors: []Contributor{
 					{
 						ID:   77447,
 						Name: "Matt Stephens",
+						Role: RoleAuthor,
 					},
 					{
 						ID:   77448,
 						Name: "Doug Rosenberg",
+						Role: RoleAuthor,
 					},
 				},
 				Annotation: `<p>Apress, 2010, 344 pp.<br />
@@ -137,8 +171,101 @@ func Test_parsePageContent(t *testing.T) {
                 <p>Design Driven Testing should appeal to developers, project managers, testers, business analysts, architects...in fact anyone who builds software that needs to be tested. While equally applicable on both large and small projects, Design Driven Testing is especially helpful to those developers who need to verify their software against formal requirements. Such developers will benefit greatly from the rational and disciplined approach espoused by the authors.</p>`,
 				Genres: []Genre{
 					{
-						ID:   81,
-						Name: "Программирование, программы, базы данных",
+						ID:    81,
+						Name:  "Программирование, программы, базы данных",
+						Code:  "comp_db",
+						Group: "computers",
+					},
+				},
+			},
+		},
+		{
+			name:     "Parsing: Путешествие Алисы",
+			filename: "test-pages/book-sample-series.html",
+			want: &Book{
+				ID:        3002,
+				ReadCount: 421,
+				Title:     "Путешествие Алисы",
+				Format:    "fb2",
+				Size:      310 * 1024,
+				Year:      1974,
+				Added:     time.Date(2009, 3, 12, 0, 0, 0, 0, time.UTC),
+				Status:    StatusActive,
+				Series: []SeriesMembership{
+					{
+						ID:     2001,
+						Title:  "Приключения Алисы",
+						Number: 2,
+					},
+					{
+						ID:     2002,
+						Title:  "Библиотека приключений и научной фантастики",
+						Number: 15,
+					},
+				},
+				Contributors: []Contributor{
+					{
+						ID:   1000,
+						Name: "Кир Булычев",
+						Role: RoleAuthor,
+					},
+				},
+				Annotation: `<p>Алиса с папой отправляются в космическую экспедицию за редкими животными для Московского зоопарка.</p>`,
+				Genres: []Genre{
+					{
+						ID:   39,
+						Name: "Детская фантастика",
+						Code: "child_sf",
+						// на сайте детская фантастика вложена в фэнтези
+						Group: "sf",
+					},
+				},
+			},
+		},
+		{
+			name:     "Parsing: Хоббит, или Туда и обратно",
+			filename: "test-pages/book-sample-translated.html",
+			want: &Book{
+				ID:                  4001,
+				ReadCount:           1520,
+				RecommendationCount: 12,
+				FileRating:          4,
+				Title:               "Хоббит, или Туда и обратно",
+				Format:              "fb2",
+				Size:                512 * 1024,
+				Year:                1976,
+				Added:               time.Date(2008, 11, 5, 0, 0, 0, 0, time.UTC),
+				Status:              StatusActive,
+				Series:              []SeriesMembership{},
+				Contributors: []Contributor{
+					{
+						ID:   5001,
+						Name: "Джон Рональд Руэл Толкин",
+						Role: RoleAuthor,
+					},
+					{
+						ID:   5002,
+						Name: "Наталья Рахманова",
+						Role: RoleTranslator,
+					},
+					{
+						ID:   5003,
+						Name: "Михаил Беломлинский",
+						Role: RoleIllustrator,
+					},
+					{
+						ID:   5004,
+						Name: "Елена Калашникова",
+						Role: RoleEditor,
+					},
+				},
+				Annotation: `<p>Повесть о путешествии хоббита Бильбо Бэггинса.</p>`,
+				Genres: []Genre{
+					{
+						ID:    41,
+						Name:  "Фэнтези",
+						Code:  "sf_fantasy",
+						Group: "sf",
 					},
 				},
 			},
@@ -166,8 +293,14 @@ func Test_parsePageContent(t *testing.T) {
 			if !reflect.DeepEqual(got.ReadCount, want.ReadCount) {
 				t.Errorf("Parse() got read count = %v, want read count %v", got.ReadCount, want.ReadCount)
 			}
-			if !reflect.DeepEqual(got.Authors, want.Authors) {
-				t.Errorf("Parse() got authors = %v, want authors %v", got.Authors, want.Authors)
+			if got.RecommendationCount != want.RecommendationCount {
+				t.Errorf("Parse() got recommendation count = %v, want recommendation count %v", got.RecommendationCount, want.RecommendationCount)
+			}
+			if got.FileRating != want.FileRating {
+				t.Errorf("Parse() got file rating = %v, want file rating %v", got.FileRating, want.FileRating)
+			}
+			if !reflect.DeepEqual(got.Contributors, want.Contributors) {
+				t.Errorf("Parse() got contributors = %v, want contributors %v", got.Contributors, want.Contributors)
 			}
 			if !reflect.DeepEqual(got.Genres, want.Genres) {
 				t.Errorf("Parse() got genres = %v, want genres %v", got.Genres, want.Genres)
@@ -175,6 +308,72 @@ func Test_parsePageContent(t *testing.T) {
 			if !reflect.DeepEqual(got.Annotation, want.Annotation) {
 				t.Errorf("Parse() got annotation = %v, want annotation %v", got.Annotation, want.Annotation)
 			}
+			if !reflect.DeepEqual(got.Format, want.Format) {
+				t.Errorf("Parse() got format = %v, want format %v", got.Format, want.Format)
+			}
+			if !reflect.DeepEqual(got.Size, want.Size) {
+				t.Errorf("Parse() got size = %v, want size %v", got.Size, want.Size)
+			}
+			if !reflect.DeepEqual(got.Pages, want.Pages) {
+				t.Errorf("Parse() got pages = %v, want pages %v", got.Pages, want.Pages)
+			}
+			if !reflect.DeepEqual(got.Year, want.Year) {
+				t.Errorf("Parse() got year = %v, want year %v", got.Year, want.Year)
+			}
+			if !got.Added.Equal(want.Added) {
+				t.Errorf("Parse() got added = %v, want added %v", got.Added, want.Added)
+			}
+			if !reflect.DeepEqual(got.Status, want.Status) {
+				t.Errorf("Parse() got status = %v, want status %v", got.Status, want.Status)
+			}
+			if !reflect.DeepEqual(got.ReplacedBy, want.ReplacedBy) {
+				t.Errorf("Parse() got replaced by = %v, want replaced by %v", got.ReplacedBy, want.ReplacedBy)
+			}
+			if !reflect.DeepEqual(got.Cover, want.Cover) {
+				t.Errorf("Parse() got cover = %v, want cover %v", got.Cover, want.Cover)
+			}
+			if !reflect.DeepEqual(got.Series, want.Series) {
+				t.Errorf("Parse() got series = %v, want series %v", got.Series, want.Series)
+			}
 		})
 	}
 }
+
+func Test_parseNewPage(t *testing.T) {
+	t.Parallel()
+	content, err := ioutil.ReadFile("test-pages/new-sample.html")
+	if err != nil {
+		log.Fatal(err)
+	}
+	t.Run("Getting the latest book ID", func(t *testing.T) {
+		got, err := parseNewPage(string(content))
+		if err != nil {
+			t.Errorf("parseNewPage() error = %v", err)
+			return
+		}
+		if got != 812345 {
+			t.Errorf("parseNewPage() got = %v, want %v", got, 812345)
+		}
+	})
+	t.Run("Failing on a page without books", func(t *testing.T) {
+		_, err := parseNewPage("<html></html>")
+		if err == nil {
+			t.Errorf("parseNewPage() error = %v, wantErr %v", err, true)
+		}
+	})
+}
+
+func Test_parseDailyIndex(t *testing.T) {
+	t.Parallel()
+	content, err := ioutil.ReadFile("test-pages/daily-index.html")
+	if err != nil {
+		log.Fatal(err)
+	}
+	want := []string{"f.fb2.811901-812034.zip", "f.fb2.812035-812190.zip"}
+	t.Run("Getting daily archives", func(t *testing.T) {
+		got := parseDailyIndex(string(content))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("parseDailyIndex() got = %v, want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package flibusta
+
+import "strings"
+
+//GenreGroup is a top level group of the FB2 genre list
+type GenreGroup struct {
+	Code  string
+	Title string
+}
+
+//GenreGroups lists the top level groups of the FB2 genre list as they are named on the site
+var GenreGroups = []GenreGroup{
+	{Code: "sf", Title: "Фантастика"},
+	{Code: "detective", Title: "Детективы и Триллеры"},
+	{Code: "prose", Title: "Проза"},
+	{Code: "love", Title: "Любовные романы"},
+	{Code: "adventure", Title: "Приключения"},
+	{Code: "children", Title: "Детское"},
+	{Code: "poetry", Title: "Поэзия"},
+	{Code: "dramaturgy", Title: "Драматургия"},
+	{Code: "antique", Title: "Старинное"},
+	{Code: "science", Title: "Наука, Образование"},
+	{Code: "computers", Title: "Компьютеры и Интернет"},
+	{Code: "reference", Title: "Справочная литература"},
+	{Code: "nonfiction", Title: "Документальная литература"},
+	{Code: "religion", Title: "Религия и духовность"},
+	{Code: "humor", Title: "Юмор"},
+	{Code: "home", Title: "Домоводство (Дом и семья)"},
+	{Code: "economics", Title: "Экономика"},
+	{Code: "military", Title: "Военное дело"},
+	{Code: "folklore", Title: "Фольклор"},
+	{Code: "other", Title: "Прочее"},
+}
+
+//genreGroupPrefixes maps the genre code prefix (the part before an underscore) to a group code
+var genreGroupPrefixes = map[string]string{
+	"sf":         "sf",
+	"det":        "detective",
+	"detective":  "detective",
+	"thriller":   "detective",
+	"prose":      "prose",
+	"love":       "love",
+	"adv":        "adventure",
+	"adventure":  "adventure",
+	"child":      "children",
+	"children":   "children",
+	"poetry":     "poetry",
+	"drama":      "dramaturgy",
+	"dramaturgy": "dramaturgy",
+	"antique":    "antique",
+	"sci":        "science",
+	"science":    "science",
+	"comp":       "computers",
+	"computers":  "computers",
+	"ref":        "reference",
+	"reference":  "reference",
+	"nonf":       "nonfiction",
+	"nonfiction": "nonfiction",
+	"religion":   "religion",
+	"humor":      "humor",
+	"home":       "home",
+	"economics":  "economics",
+	"military":   "military",
+	"folklore":   "folklore",
+	"folk":       "folklore",
+	"other":      "other",
+}
+
+//GenreGroupOf returns the group code of a genre code or an empty string if the group is unknown.
+//It guesses the group by the code prefix, so the book pages use genreGroupOfPage instead.
+func GenreGroupOf(code string) string {
+	prefix := strings.SplitN(code, "_", 2)[0]
+	return genreGroupPrefixes[prefix]
+}
+
+//genreGroupOfPage returns the group code of the genre listed on the book page in the div with the classes
+//like "g-computers g-comp_db", the first g-* class is the parent of the genre on the site
+func genreGroupOfPage(classes, code string) string {
+	for _, class := range strings.Fields(classes) {
+		if !strings.HasPrefix(class, "g-") {
+			continue
+		}
+		// родитель может быть и группой, и жанром вроде sf_fantasy, поэтому он приводится к коду группы
+		if group := GenreGroupOf(strings.TrimPrefix(class, "g-")); group != "" {
+			return group
+		}
+		break
+	}
+	return GenreGroupOf(code)
+}
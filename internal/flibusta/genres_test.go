@@ -0,0 +1,28 @@
+package flibusta
+
+import "testing"
+
+func Test_genreGroupOfPage(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		classes string
+		code    string
+		want    string
+	}{
+		{name: "Group class", classes: "g-computers g-comp_db", code: "comp_db", want: "computers"},
+		{name: "Parent genre class", classes: "g-sf_fantasy g-fantasy_fight", code: "fantasy_fight", want: "sf"},
+		{name: "Own class", classes: "g-comp_db", code: "comp_db", want: "computers"},
+		{name: "Unknown parent", classes: "g-popadanec", code: "popadanec", want: ""},
+		{name: "No classes", classes: "", code: "sf_social", want: "sf"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := genreGroupOfPage(tt.classes, tt.code); got != tt.want {
+				t.Errorf("genreGroupOfPage() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
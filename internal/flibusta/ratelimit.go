@@ -0,0 +1,195 @@
+package flibusta
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//RateLimit configures the request throttling shared by all users of the client
+type RateLimit struct {
+	//Rate is the number of requests per second, zero disables the limit
+	Rate float64
+	//Burst is the number of requests allowed to go at once
+	Burst int
+	//Jitter is the maximum random delay added to every request
+	Jitter time.Duration
+	//MaxRetries is the number of retries of a 429 or 503 response
+	MaxRetries int
+	//Backoff is the initial retry delay used when the site does not send Retry-After, it doubles on every retry
+	Backoff time.Duration
+	//MaxBackoff limits the retry delay
+	MaxBackoff time.Duration
+}
+
+//DefaultRateLimit is polite enough for a long crawl with a single account
+var DefaultRateLimit = RateLimit{
+	Rate:       2,
+	Burst:      4,
+	Jitter:     500 * time.Millisecond,
+	MaxRetries: 5,
+	Backoff:    5 * time.Second,
+	MaxBackoff: 5 * time.Minute,
+}
+
+//tokenBucket is a token bucket rate limiter which can also be paused by the server
+type tokenBucket struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	now         func() time.Time
+	sleep       func(ctx context.Context, d time.Duration) error
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+		sleep:  sleep,
+	}
+}
+
+//sleep waits for the duration or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//reserve takes a token and returns how long the caller has to wait before using it
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	var wait time.Duration
+	if b.pausedUntil.After(now) {
+		wait = b.pausedUntil.Sub(now)
+	}
+	if b.rate <= 0 {
+		return wait
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	// токен может уйти в минус, тогда следующий запрос ждет пока он восстановится
+	b.tokens--
+	if b.tokens < 0 {
+		if deficit := time.Duration(-b.tokens / b.rate * float64(time.Second)); deficit > wait {
+			wait = deficit
+		}
+	}
+	return wait
+}
+
+//wait blocks until the request is allowed or the context is done
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if d := b.reserve(); d > 0 {
+		return b.sleep(ctx, d)
+	}
+	return nil
+}
+
+//pause stops all the requests for the duration
+func (b *tokenBucket) pause(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if until := b.now().Add(d); until.After(b.pausedUntil) {
+		b.pausedUntil = until
+	}
+}
+
+//rateLimitedTransport throttles the requests and retries the ones the site refused because of the load
+type rateLimitedTransport struct {
+	next   http.RoundTripper
+	limit  RateLimit
+	bucket *tokenBucket
+}
+
+func newRateLimitedTransport(next http.RoundTripper, limit RateLimit) *rateLimitedTransport {
+	return &rateLimitedTransport{
+		next:   next,
+		limit:  limit,
+		bucket: newTokenBucket(limit.Rate, limit.Burst),
+	}
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		// отмененный запрос не должен ждать своей очереди
+		if err := t.bucket.wait(req.Context()); err != nil {
+			return nil, err
+		}
+		if t.limit.Jitter > 0 {
+			if err := t.bucket.sleep(req.Context(), time.Duration(rand.Int63n(int64(t.limit.Jitter)))); err != nil {
+				return nil, err
+			}
+		}
+		if attempt > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, errors.New("error retrying the request: the body can not be read again")
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, errors.Wrap(err, "error retrying the request")
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, nil
+		}
+		if attempt >= t.limit.MaxRetries {
+			return resp, nil
+		}
+		delay := retryAfter(resp, t.bucket.now())
+		if delay <= 0 {
+			delay = t.limit.Backoff << uint(attempt)
+		}
+		if t.limit.MaxBackoff > 0 && delay > t.limit.MaxBackoff {
+			delay = t.limit.MaxBackoff
+		}
+		resp.Body.Close()
+		// сайт перегружен, поэтому ждут все воркеры, а не только получивший ответ
+		t.bucket.pause(delay)
+	}
+}
+
+//retryAfter returns the delay from the Retry-After header, zero if there is none
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+package flibusta
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_tokenBucket_reserve(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	bucket := newTokenBucket(2, 2)
+	bucket.now = func() time.Time { return now }
+	var got []time.Duration
+	for i := 0; i < 4; i++ {
+		got = append(got, bucket.reserve())
+	}
+	want := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reserve() got = %v, want %v", got, want)
+	}
+	now = now.Add(2 * time.Second)
+	bucket.pause(3 * time.Second)
+	if got := bucket.reserve(); got != 3*time.Second {
+		t.Errorf("reserve() after pause got = %v, want %v", got, 3*time.Second)
+	}
+}
+
+func Test_rateLimitedTransport_RoundTrip(t *testing.T) {
+	t.Parallel()
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		calls = append(calls, r.Form.Get("name"))
+		if len(calls) < 3 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	transport := newRateLimitedTransport(http.DefaultTransport, RateLimit{MaxRetries: 5, Backoff: time.Second})
+	var slept []time.Duration
+	transport.bucket.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	transport.bucket.now = func() time.Time { return time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC) }
+	client := &http.Client{Transport: transport}
+	resp, err := client.Post(server.URL, "application/x-www-form-urlencoded", strings.NewReader("name=alice"))
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("RoundTrip() got status = %v, want status %v", resp.StatusCode, http.StatusOK)
+	}
+	if want := []string{"alice", "alice", "alice"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("RoundTrip() got calls = %v, want calls %v", calls, want)
+	}
+	if want := []time.Duration{7 * time.Second, 7 * time.Second}; !reflect.DeepEqual(slept, want) {
+		t.Errorf("RoundTrip() got delays = %v, want delays %v", slept, want)
+	}
+}
+
+func Test_retryAfter(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "Seconds", value: "120", want: 2 * time.Minute},
+		{name: "Date", value: "Thu, 01 Apr 2021 12:00:30 GMT", want: 30 * time.Second},
+		{name: "Missing", value: "", want: 0},
+		{name: "Garbage", value: "soon", want: 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			resp := &http.Response{Header: http.Header{}}
+			resp.Header.Set("Retry-After", tt.value)
+			if got := retryAfter(resp, now); got != tt.want {
+				t.Errorf("retryAfter() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_rateLimitedTransport_RoundTrip_cancelled(t *testing.T) {
+	t.Parallel()
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	transport := newRateLimitedTransport(http.DefaultTransport, RateLimit{MaxRetries: 5, Backoff: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = transport.RoundTrip(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RoundTrip() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("RoundTrip() waited %v after the request was cancelled", elapsed)
+	}
+	if calls != 1 {
+		t.Errorf("RoundTrip() got calls = %v, want calls %v", calls, 1)
+	}
+}
@@ -0,0 +1,72 @@
+package flibusta
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Review is a public impression of a user listed on the book page
+type Review struct {
+	UserID int
+	User   string
+	Date   time.Time
+	// Rating is from 1 to 5, zero if the user did not rate the book
+	Rating int
+	Text   string
+}
+
+//reviewRatings are the rating names of the review form on the book page
+var reviewRatings = map[string]int{
+	"нечитаемо": 1,
+	"плохо":     2,
+	"неплохо":   3,
+	"хорошо":    4,
+	"отлично!":  5,
+}
+
+//parseReviews fetches the reviews listed in the main block of the book page
+func parseReviews(content string) []Review {
+	reviews := []Review{}
+	// ищем только в основном блоке после аннотации: в боковом блоке последние впечатления о других книгах
+	start := strings.Index(content, "<h2>Аннотация</h2>")
+	if start == -1 {
+		return reviews
+	}
+	content = content[start:]
+	if end := strings.Index(content, `<div id="sidebar-right"`); end != -1 {
+		content = content[:end]
+	}
+	userPattern := regexp.MustCompile(`<a href="/polka/show/(\d+)">(.*?)</a>`)
+	datePattern := regexp.MustCompile(`(\d{2})[.-](\d{2})[.-](\d{4})`)
+	ratingPattern := regexp.MustCompile(`(нечитаемо|неплохо|плохо|хорошо|отлично!)`)
+	tagPattern := regexp.MustCompile(`<[^>]+>`)
+	breakPattern := regexp.MustCompile(`(?i)<br\s*/?>`)
+	for _, m := range regexp.MustCompile(`(?s)<div class="container_\d+">(.*?)<hr>`).FindAllStringSubmatch(content, -1) {
+		// в заголовке до первого переноса строки пользователь, дата и оценка, дальше текст отзыва
+		parts := breakPattern.Split(m[1], -1)
+		user := userPattern.FindStringSubmatch(parts[0])
+		if user == nil {
+			continue
+		}
+		var review Review
+		review.UserID, _ = strconv.Atoi(user[1])
+		review.User = html.UnescapeString(strings.TrimSpace(user[2]))
+		header := tagPattern.ReplaceAllString(parts[0][strings.Index(parts[0], user[0])+len(user[0]):], "")
+		if date := datePattern.FindStringSubmatch(header); date != nil {
+			review.Date, _ = time.Parse("02.01.2006", date[1]+"."+date[2]+"."+date[3])
+		}
+		if rating := ratingPattern.FindString(header); rating != "" {
+			review.Rating = reviewRatings[rating]
+		}
+		var lines []string
+		for _, line := range parts[1:] {
+			lines = append(lines, strings.TrimSpace(html.UnescapeString(tagPattern.ReplaceAllString(line, ""))))
+		}
+		review.Text = strings.TrimSpace(strings.Join(lines, "\n"))
+		reviews = append(reviews, review)
+	}
+	return reviews
+}
@@ -0,0 +1,62 @@
+package flibusta
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_parseReviews(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		filename string
+		want     []Review
+	}{
+		{
+			name:     "Book with reviews",
+			filename: "test-pages/book-sample-reviews.html",
+			want: []Review{
+				{
+					UserID: 893067,
+					User:   "Kalina_krasnaya",
+					Date:   time.Date(2021, 2, 14, 0, 0, 0, 0, time.UTC),
+					Rating: 5,
+					Text:   "Перечитываю каждый год.\n\"Понедельник начинается в субботу\" - лучшее у Стругацких.",
+				},
+				{
+					UserID: 30373,
+					User:   "Гость & друг",
+					Date:   time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+					Rating: 3,
+					Text:   "Вторая часть слабее первой.",
+				},
+				{
+					UserID: 117215,
+					User:   "reader",
+					Text:   "Без оценки.",
+				},
+			},
+		},
+		{
+			// в боковом блоке впечатления о других книгах
+			name:     "Book without reviews",
+			filename: "test-pages/book-9.html",
+			want:     []Review{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			content, err := ioutil.ReadFile(tt.filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := parseReviews(string(content)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseReviews() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package flibusta
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//SeriesMembership is a series a book belongs to
+type SeriesMembership struct {
+	ID     int
+	Title  string
+	Number int
+}
+
+//Series is the series page content
+type Series struct {
+	ID    int
+	Title string
+	Books []SeriesBook
+}
+
+//SeriesBook is a book listed on the series page
+type SeriesBook struct {
+	ID     int
+	Title  string
+	Number int
+}
+
+//GetSeries fetches the series page
+func (f *Flibusta) GetSeries(ctx context.Context, id int) (*Series, error) {
+	content, err := f.getPage(ctx, f.url("/s/"+strconv.Itoa(id)), "series")
+	if err != nil {
+		return nil, err
+	}
+	series, err := parseSeriesPage(content)
+	if err != nil {
+		return nil, parseFailed(err)
+	}
+	series.ID = id
+	return series, nil
+}
+
+//parseBookSeries fetches series links like "(Title - 2)" from the book page header
+func parseBookSeries(content string) []SeriesMembership {
+	series := []SeriesMembership{}
+	// ищем только между заголовком и аннотацией, чтобы не зацепить ссылки из боковых блоков
+	match := regexp.MustCompile(`(?s)<h1 class="title">(.*?)<h2>Аннотация</h2>`).FindStringSubmatch(content)
+	if match == nil {
+		return series
+	}
+	linkPattern := regexp.MustCompile(`<a href="/s/(\d+)">\(?(.*?)(?:\s+-\s+(\d+))?\)?</a>`)
+	for _, m := range linkPattern.FindAllStringSubmatch(match[1], -1) {
+		var s SeriesMembership
+		s.ID, _ = strconv.Atoi(m[1])
+		s.Title = strings.TrimSpace(m[2])
+		if m[3] != "" {
+			s.Number, _ = strconv.Atoi(m[3])
+		}
+		series = append(series, s)
+	}
+	return series
+}
+
+//parseSeriesPage fetches the series info from a page content
+func parseSeriesPage(content string) (*Series, error) {
+	var page Series
+
+	// получаем название сериала
+	match := regexp.MustCompile(`<h1 class="title">(.*?)</h1>`).FindStringSubmatch(content)
+	if match == nil {
+		return nil, errors.New("error getting the series title")
+	}
+	page.Title = strings.TrimSpace(match[1])
+
+	// получаем список книг в порядке следования. номер в сериале указан не у всех книг
+	page.Books = []SeriesBook{}
+	match = regexp.MustCompile(`(?s)<form method="POST" action="/mass/download">(.*?)</form>`).FindStringSubmatch(content)
+	if match == nil {
+		return &page, nil
+	}
+	bookPattern := regexp.MustCompile(`(?:(\d+)\.\s+)?<a href="/b/(\d+)">(.*?)</a>`)
+	for _, m := range bookPattern.FindAllStringSubmatch(match[1], -1) {
+		var book SeriesBook
+		if m[1] != "" {
+			book.Number, _ = strconv.Atoi(m[1])
+		}
+		book.ID, _ = strconv.Atoi(m[2])
+		book.Title = strings.TrimSpace(m[3])
+		page.Books = append(page.Books, book)
+	}
+
+	return &page, nil
+}
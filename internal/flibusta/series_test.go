@@ -0,0 +1,48 @@
+package flibusta
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func Test_parseSeriesPage(t *testing.T) {
+	t.Parallel()
+	content, err := ioutil.ReadFile("test-pages/series-sample.html")
+	if err != nil {
+		log.Fatal(err)
+	}
+	want := &Series{
+		Title: "Приключения Алисы",
+		Books: []SeriesBook{
+			{
+				ID:     3001,
+				Title:  "Девочка, с которой ничего не случится",
+				Number: 1,
+			},
+			{
+				ID:     3002,
+				Title:  "Путешествие Алисы",
+				Number: 2,
+			},
+			{
+				ID:    3005,
+				Title: "Алиса и крестоносцы",
+			},
+		},
+	}
+	t.Run("Parsing: Приключения Алисы", func(t *testing.T) {
+		got, err := parseSeriesPage(string(content))
+		if err != nil {
+			t.Errorf("parseSeriesPage() error = %v", err)
+			return
+		}
+		if !reflect.DeepEqual(got.Title, want.Title) {
+			t.Errorf("parseSeriesPage() got title = %v, want title %v", got.Title, want.Title)
+		}
+		if !reflect.DeepEqual(got.Books, want.Books) {
+			t.Errorf("parseSeriesPage() got books = %v, want books %v", got.Books, want.Books)
+		}
+	})
+}
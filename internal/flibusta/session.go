@@ -0,0 +1,108 @@
+package flibusta
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+//isGuestPage reports whether the page is shown to a logged out user, the login form is only there for guests
+func isGuestPage(content string) bool {
+	return strings.Contains(content, `id="user-login-form"`)
+}
+
+//checkSession makes sure the site sees the client logged in
+func (f *Flibusta) checkSession() error {
+	res, err := f.client.Get(f.url("/"))
+	if err != nil {
+		return errors.Wrap(err, "error checking for authorization status")
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.New("error reading authorized page response body")
+	}
+	if res.StatusCode != 200 || isGuestPage(string(body)) {
+		return errors.New("error checking for authorization status: the site shows the guest page")
+	}
+	return nil
+}
+
+//sessionID returns the number of the current session
+func (f *Flibusta) sessionID() int {
+	f.authMu.Lock()
+	defer f.authMu.Unlock()
+	return f.session
+}
+
+//relogin logs in again unless another worker has already done it since the session was seen
+func (f *Flibusta) relogin(seen int) error {
+	f.authMu.Lock()
+	defer f.authMu.Unlock()
+	if f.session != seen {
+		return nil
+	}
+	if f.username == "" {
+		return errors.New("error logging in again: the client was never authorized")
+	}
+	return f.login()
+}
+
+//withSession calls fn and repeats it once after logging in again if the session has expired
+func (f *Flibusta) withSession(fn func() error) error {
+	seen := f.sessionID()
+	err := fn()
+	if ClassOf(err) != ErrAuthRequired || seen == 0 {
+		return err
+	}
+	if err := f.relogin(seen); err != nil {
+		return classified(ErrAuthRequired, 0, errors.Wrap(err, "error restoring the session"))
+	}
+	return fn()
+}
+
+//storedCookie is a cookie saved in the cookie file
+type storedCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+//loadCookies puts the cookies from the file into the jar, it returns false if there is no file yet
+func (f *Flibusta) loadCookies() (bool, error) {
+	content, err := ioutil.ReadFile(f.cookieFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "error reading the cookie file")
+	}
+	var stored []storedCookie
+	if err = json.Unmarshal(content, &stored); err != nil {
+		return false, errors.Wrap(err, "error decoding the cookie file")
+	}
+	var cookies []*http.Cookie
+	for _, c := range stored {
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	f.client.Jar.SetCookies(f.baseURL, cookies)
+	return len(cookies) > 0, nil
+}
+
+//saveCookies writes the session cookies into the file readable by the owner only
+func (f *Flibusta) saveCookies() error {
+	var stored []storedCookie
+	for _, c := range f.client.Jar.Cookies(f.baseURL) {
+		stored = append(stored, storedCookie{Name: c.Name, Value: c.Value})
+	}
+	content, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error encoding the cookies")
+	}
+	if err = ioutil.WriteFile(f.cookieFile, content, 0600); err != nil {
+		return errors.Wrap(err, "error writing the cookie file")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package flibusta
+
+import (
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_isGuestPage(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		file string
+		want bool
+	}{
+		{name: "Guest", file: "test-pages/guest-index.html", want: true},
+		{name: "Logged in", file: "test-pages/book-611196.html", want: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			content, err := ioutil.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := isGuestPage(string(content)); got != tt.want {
+				t.Errorf("isGuestPage() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlibusta_withSession(t *testing.T) {
+	t.Parallel()
+	f := &Flibusta{username: "user", password: "password", session: 1}
+	var calls int
+	err := f.withSession(func() error {
+		calls++
+		if calls == 1 {
+			// другой воркер уже вошел заново, пока шел этот запрос
+			f.session++
+			return classified(ErrAuthRequired, 302, errors.New("redirected to the login page"))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("withSession() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("withSession() got calls = %v, want calls %v", calls, 2)
+	}
+	notFound := classified(ErrNotFound, 404, errors.New("not found"))
+	if err = f.withSession(func() error { return notFound }); err != notFound {
+		t.Errorf("withSession() error = %v, want %v", err, notFound)
+	}
+}
+
+func TestFlibusta_cookies(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "cookies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cookies.json")
+	newFlibusta := func() *Flibusta {
+		client, err := NewClient(Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		base, _ := parseSiteURL("")
+		return &Flibusta{client: client, baseURL: base, cookieFile: path}
+	}
+	first := newFlibusta()
+	if loaded, err := first.loadCookies(); err != nil || loaded {
+		t.Errorf("loadCookies() without a file got = %v, %v, want false, nil", loaded, err)
+	}
+	first.client.Jar.SetCookies(first.baseURL, []*http.Cookie{{Name: "PHPSESSID", Value: "0123456789abcdef"}})
+	if err = first.saveCookies(); err != nil {
+		t.Fatalf("saveCookies() error = %v", err)
+	}
+	second := newFlibusta()
+	if loaded, err := second.loadCookies(); err != nil || !loaded {
+		t.Errorf("loadCookies() got = %v, %v, want true, nil", loaded, err)
+	}
+	got := second.client.Jar.Cookies(second.baseURL)
+	want := []*http.Cookie{{Name: "PHPSESSID", Value: "0123456789abcdef"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadCookies() got cookies = %v, want cookies %v", got, want)
+	}
+}
@@ -0,0 +1,124 @@
+package flibusta
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+//DefaultBaseURL is the main address of the site
+const DefaultBaseURL = "https://flibusta.is"
+
+//DefaultUserAgent is sent with every request unless another one is set
+const DefaultUserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/89.0.4389.82 Safari/537.36"
+
+//newTransport creates the transport dialing through the proxy, an empty proxy falls back to the environment
+func newTransport(proxy string, connectTimeout time.Duration) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing the proxy address")
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, errors.Errorf("error parsing the proxy address: unsupported scheme %s", proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if connectTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = connectTimeout
+	}
+	return transport, nil
+}
+
+//mirrorTransport sends the requests for the base URL to the first reachable mirror and sets the User-Agent.
+//The client and its cookie jar only see the base URL, so the session is shared by the mirrors.
+type mirrorTransport struct {
+	next      http.RoundTripper
+	base      *url.URL
+	mirrors   []*url.URL
+	userAgent string
+	mu        sync.Mutex
+	current   int
+}
+
+func newMirrorTransport(next http.RoundTripper, base *url.URL, mirrors []*url.URL, userAgent string) *mirrorTransport {
+	return &mirrorTransport{
+		next:      next,
+		base:      base,
+		mirrors:   append([]*url.URL{base}, mirrors...),
+		userAgent: userAgent,
+	}
+}
+
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	if req.URL.Host != t.base.Host {
+		return t.next.RoundTrip(req)
+	}
+	t.mu.Lock()
+	start := t.current
+	t.mu.Unlock()
+	var lastErr error
+	for i := 0; i < len(t.mirrors); i++ {
+		index := (start + i) % len(t.mirrors)
+		mirror := t.mirrors[index]
+		attempt := req.Clone(req.Context())
+		attempt.URL.Scheme = mirror.Scheme
+		attempt.URL.Host = mirror.Host
+		attempt.Host = mirror.Host
+		if i > 0 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, lastErr
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, errors.Wrap(err, "error retrying the request on a mirror")
+			}
+			attempt.Body = body
+		}
+		resp, err := t.next.RoundTrip(attempt)
+		if err != nil {
+			// на другое зеркало переключаемся только при ошибке соединения, а не по ответу сайта
+			if req.Context().Err() != nil || !isConnectionError(err) {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		if index != start {
+			t.mu.Lock()
+			t.current = index
+			t.mu.Unlock()
+		}
+		resp.Request = req
+		if location, err := resp.Location(); err == nil && location.Host == mirror.Host {
+			location.Scheme = t.base.Scheme
+			location.Host = t.base.Host
+			resp.Header.Set("Location", location.String())
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+//isConnectionError reports whether the site could not be reached at all
+func isConnectionError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) || errors.As(err, &dnsErr) || (errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -0,0 +1,73 @@
+package flibusta
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_mirrorTransport_RoundTrip(t *testing.T) {
+	t.Parallel()
+	var userAgents []string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.UserAgent())
+		if r.URL.Path == "/b/1/download" {
+			http.Redirect(w, r, "http://"+r.Host+"/b/1/fb2", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mirror.Close()
+	// на порту 1 никто не слушает, поэтому основной адрес недоступен
+	client, err := NewClient(Options{BaseURL: "http://127.0.0.1:1", Mirrors: []string{mirror.URL}, UserAgent: "test-agent"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get("http://127.0.0.1:1/b/1/download")
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	resp.Body.Close()
+	if got, want := resp.Header.Get("Location"), "http://127.0.0.1:1/b/1/fb2"; got != want {
+		t.Errorf("RoundTrip() got location = %v, want location %v", got, want)
+	}
+	if got, want := resp.Request.URL.Host, "127.0.0.1:1"; got != want {
+		t.Errorf("RoundTrip() got request host = %v, want request host %v", got, want)
+	}
+	resp, err = client.Get("http://127.0.0.1:1/b/1/fb2")
+	if err != nil {
+		t.Fatalf("RoundTrip() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("RoundTrip() got status = %v, want status %v", resp.StatusCode, http.StatusOK)
+	}
+	for _, got := range userAgents {
+		if got != "test-agent" {
+			t.Errorf("RoundTrip() got user agent = %v, want user agent %v", got, "test-agent")
+		}
+	}
+}
+
+func Test_newTransport(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		proxy   string
+		wantErr bool
+	}{
+		{name: "Environment", proxy: ""},
+		{name: "HTTP", proxy: "http://127.0.0.1:3128"},
+		{name: "Tor", proxy: "socks5://127.0.0.1:9050"},
+		{name: "Unsupported", proxy: "ftp://127.0.0.1:21", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := newTransport(tt.proxy, 0); (err != nil) != tt.wantErr {
+				t.Errorf("newTransport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+//Package flibustatest runs a fake Flibusta site for the integration tests
+package flibustatest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+//SessionCookie is the name of the cookie the fake site keeps the session in
+const SessionCookie = "SESS"
+
+//Fault replaces the response of a path
+type Fault struct {
+	//Status is sent instead of the page, zero keeps the page
+	Status int
+	//Location is sent with the redirect statuses
+	Location string
+	//RetryAfter is sent with the 429 and 503 statuses
+	RetryAfter string
+	//Delay holds the response back
+	Delay time.Duration
+	//Times is how many requests get the fault, zero means all of them
+	Times int
+}
+
+//Server is a fake Flibusta site serving the pages from a fixture directory:
+//the guest page from guest-index.html and the pages /b/{id}, /a/{id}, /s/{id}, /new and /daily/
+//from book-{id}.html, author-{id}.html, series-{id}.html, new-sample.html and daily-index.html.
+//The pages except the index require a login, guests are redirected to the login page.
+type Server struct {
+	*httptest.Server
+	Username string
+	Password string
+	dir      string
+	mu       sync.Mutex
+	sessions map[string]bool
+	faults   map[string]*Fault
+	requests map[string]int
+	contents map[string][]byte
+	logins   int
+}
+
+//NewServer starts the site accepting the credentials, the caller must close it
+func NewServer(dir, username, password string) *Server {
+	s := &Server{
+		Username: username,
+		Password: password,
+		dir:      dir,
+		sessions: map[string]bool{},
+		faults:   map[string]*Fault{},
+		requests: map[string]int{},
+		contents: map[string][]byte{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+//Inject sets the fault for the path like /b/123
+func (s *Server) Inject(path string, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[path] = &fault
+}
+
+//Serve sets the content of the path like /i/1/cover.jpg, it is given to the logged in clients only
+func (s *Server) Serve(path string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contents[path] = content
+}
+
+//ExpireSessions logs out all the clients
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = map[string]bool{}
+}
+
+//Requests returns how many times the path was requested
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+//Logins returns the number of successful logins
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	fault := s.track(r.URL.Path)
+	if fault != nil {
+		time.Sleep(fault.Delay)
+		if fault.Status != 0 {
+			if fault.Location != "" {
+				w.Header().Set("Location", fault.Location)
+			}
+			if fault.RetryAfter != "" {
+				w.Header().Set("Retry-After", fault.RetryAfter)
+			}
+			w.WriteHeader(fault.Status)
+			return
+		}
+	}
+	switch {
+	case r.URL.Path == "/node" && r.Method == http.MethodPost:
+		s.login(w, r)
+	case r.URL.Path == "/" || r.URL.Path == "/node":
+		if s.loggedIn(r) {
+			s.write(w, []byte(`<html><body><div id="user-bar"><a href="/user/1">`+s.Username+`</a></div></body></html>`))
+			return
+		}
+		s.serveFile(w, "guest-index.html")
+	case !s.loggedIn(r):
+		http.Redirect(w, r, "/user/login?destination="+strings.TrimPrefix(r.URL.Path, "/"), http.StatusFound)
+	case s.content(r.URL.Path) != nil:
+		_, _ = w.Write(s.content(r.URL.Path))
+	case r.URL.Path == "/new":
+		s.serveFile(w, "new-sample.html")
+	case r.URL.Path == "/daily/":
+		s.serveFile(w, "daily-index.html")
+	case strings.HasPrefix(r.URL.Path, "/b/"):
+		s.serveFile(w, "book-"+strings.TrimPrefix(r.URL.Path, "/b/")+".html")
+	case strings.HasPrefix(r.URL.Path, "/a/"):
+		s.serveFile(w, "author-"+strings.TrimPrefix(r.URL.Path, "/a/")+".html")
+	case strings.HasPrefix(r.URL.Path, "/s/"):
+		s.serveFile(w, "series-"+strings.TrimPrefix(r.URL.Path, "/s/")+".html")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+//track counts the request and returns the fault to apply
+func (s *Server) track(path string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[path]++
+	fault, ok := s.faults[path]
+	if !ok {
+		return nil
+	}
+	if fault.Times > 0 {
+		fault.Times--
+		if fault.Times == 0 {
+			delete(s.faults, path)
+		}
+	}
+	return fault
+}
+
+//content returns the content set for the path, nil if there is none
+func (s *Server) content(path string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.contents[path]
+}
+
+func (s *Server) loggedIn(r *http.Request) bool {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[cookie.Value]
+}
+
+//login checks the login form like the real site: a redirect on success, the guest page again on failure
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.PostForm.Get("form_id") != "user_login_block" || r.PostForm.Get("name") != s.Username || r.PostForm.Get("pass") != s.Password {
+		s.serveFile(w, "guest-index.html")
+		return
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session := hex.EncodeToString(token)
+	s.mu.Lock()
+	s.sessions[session] = true
+	s.logins++
+	s.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: session, Path: "/", HttpOnly: true})
+	http.Redirect(w, r, "/node", http.StatusFound)
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, name string) {
+	content, err := ioutil.ReadFile(filepath.Join(s.dir, filepath.Base(name)))
+	if os.IsNotExist(err) {
+		http.Error(w, "page not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.write(w, content)
+}
+
+func (s *Server) write(w http.ResponseWriter, content []byte) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(content)
+}
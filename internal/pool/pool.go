@@ -0,0 +1,146 @@
+package pool
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+type Work struct {
+	ID       int
+	BookID   int
+	AuthorID int
+	SeriesID int
+}
+
+//Handler does a job, the returned error only counts the job as failed
+type Handler func(ctx context.Context, work Work) error
+
+//Summary counts the jobs done by the pool
+type Summary struct {
+	Processed int
+	Failed    int
+}
+
+//Pool runs the handler on the submitted jobs with a resizable set of workers
+type Pool struct {
+	ctx       context.Context
+	handler   Handler
+	queue     chan Work
+	closeOnce sync.Once
+	running   sync.WaitGroup
+	mu        sync.Mutex
+	workers   []*worker
+	lastID    int
+	summary   Summary
+}
+
+//New starts the pool with the workers and a queue of the size. The workers stop once the pool is
+//closed and the queue is drained or once the context is cancelled and the current jobs are done.
+func New(ctx context.Context, workers, queueSize int, handler Handler) *Pool {
+	p := &Pool{
+		ctx:     ctx,
+		handler: handler,
+		queue:   make(chan Work, queueSize),
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := 0; i < workers; i++ {
+		p.startWorker()
+	}
+	return p
+}
+
+//Submit queues the job, it returns false when a context is cancelled and the job is dropped.
+//Submitting to a closed pool panics.
+func (p *Pool) Submit(ctx context.Context, work Work) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-p.ctx.Done():
+		return false
+	default:
+	}
+	select {
+	case p.queue <- work:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+//Close stops accepting the jobs, the queued ones are still done
+func (p *Pool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.queue)
+	})
+}
+
+//Wait blocks until all the workers stop and returns the summary
+func (p *Pool) Wait() Summary {
+	p.running.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.summary
+}
+
+//Size returns the current number of workers
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.workers)
+}
+
+//Resize starts or stops the workers to get the count, the stopped ones finish their current jobs
+func (p *Pool) Resize(count int) error {
+	if count < 1 {
+		return errors.Errorf("error resizing the pool: the pool needs at least one worker, got %d", count)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.workers) < count {
+		p.startWorker()
+	}
+	for len(p.workers) > count {
+		last := p.workers[len(p.workers)-1]
+		p.workers = p.workers[:len(p.workers)-1]
+		close(last.quit)
+	}
+	return nil
+}
+
+//startWorker must be called with the lock held
+func (p *Pool) startWorker() {
+	p.lastID++
+	w := &worker{id: p.lastID, quit: make(chan struct{})}
+	p.workers = append(p.workers, w)
+	p.running.Add(1)
+	go func() {
+		defer p.running.Done()
+		w.run(p)
+	}()
+}
+
+//finish counts the result of a job
+func (p *Pool) finish(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.summary.Processed++
+	if err != nil {
+		p.summary.Failed++
+	}
+}
+
+//exited forgets the worker which stopped by itself
+func (p *Pool) exited(w *worker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, other := range p.workers {
+		if other == w {
+			p.workers = append(p.workers[:i], p.workers[i+1:]...)
+			return
+		}
+	}
+}
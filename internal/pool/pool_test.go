@@ -0,0 +1,136 @@
+package pool
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+//fakeHandler records the jobs and fails the ones with odd IDs
+type fakeHandler struct {
+	mu      sync.Mutex
+	jobs    []int
+	workers map[int]bool
+	started chan int
+	release chan struct{}
+}
+
+func newFakeHandler() *fakeHandler {
+	return &fakeHandler{workers: map[int]bool{}}
+}
+
+func (h *fakeHandler) handle(ctx context.Context, work Work) error {
+	if h.started != nil {
+		h.started <- work.ID
+	}
+	if h.release != nil {
+		<-h.release
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.jobs = append(h.jobs, work.ID)
+	h.workers[WorkerID(ctx)] = true
+	if work.ID%2 == 1 {
+		return errors.New("odd job")
+	}
+	return nil
+}
+
+func (h *fakeHandler) done() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	jobs := append([]int(nil), h.jobs...)
+	sort.Ints(jobs)
+	return jobs
+}
+
+func TestPool_Wait(t *testing.T) {
+	t.Parallel()
+	h := newFakeHandler()
+	p := New(context.Background(), 3, 2, h.handle)
+	for i := 0; i < 10; i++ {
+		if !p.Submit(context.Background(), Work{ID: i}) {
+			t.Fatalf("Submit() dropped the job %d", i)
+		}
+	}
+	p.Close()
+	got := p.Wait()
+	if want := (Summary{Processed: 10, Failed: 5}); got != want {
+		t.Errorf("Wait() got = %+v, want %+v", got, want)
+	}
+	if want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !reflect.DeepEqual(h.done(), want) {
+		t.Errorf("Wait() got jobs = %v, want jobs %v", h.done(), want)
+	}
+	for id := range h.workers {
+		if id < 1 || id > 3 {
+			t.Errorf("WorkerID() got = %v, want 1..3", id)
+		}
+	}
+}
+
+func TestPool_Cancel(t *testing.T) {
+	t.Parallel()
+	h := newFakeHandler()
+	h.started = make(chan int)
+	h.release = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New(ctx, 1, 5, h.handle)
+	for i := 0; i < 4; i++ {
+		p.Submit(ctx, Work{ID: i})
+	}
+	<-h.started
+	cancel()
+	close(h.release)
+	if p.Submit(ctx, Work{ID: 10}) {
+		t.Errorf("Submit() after cancel got = true, want false")
+	}
+	got := p.Wait()
+	// начатая задача доделывается, остальные из очереди отбрасываются
+	if want := (Summary{Processed: 1}); got != want {
+		t.Errorf("Wait() got = %+v, want %+v", got, want)
+	}
+}
+
+func TestPool_Resize(t *testing.T) {
+	t.Parallel()
+	h := newFakeHandler()
+	h.started = make(chan int, 10)
+	h.release = make(chan struct{})
+	p := New(context.Background(), 1, 10, h.handle)
+	if err := p.Resize(3); err != nil {
+		t.Fatalf("Resize() error = %v", err)
+	}
+	if got := p.Size(); got != 3 {
+		t.Errorf("Size() got = %v, want %v", got, 3)
+	}
+	for i := 0; i < 3; i++ {
+		p.Submit(context.Background(), Work{ID: i * 2})
+	}
+	// три задачи выполняются одновременно только если воркеров три
+	for i := 0; i < 3; i++ {
+		select {
+		case <-h.started:
+		case <-time.After(time.Second):
+			t.Fatalf("Resize() got %d jobs running, want 3", i)
+		}
+	}
+	if err := p.Resize(1); err != nil {
+		t.Fatalf("Resize() error = %v", err)
+	}
+	if got := p.Size(); got != 1 {
+		t.Errorf("Size() got = %v, want %v", got, 1)
+	}
+	if err := p.Resize(0); err == nil {
+		t.Errorf("Resize(0) error = nil, want an error")
+	}
+	close(h.release)
+	p.Submit(context.Background(), Work{ID: 6})
+	p.Close()
+	if want := (Summary{Processed: 4}); p.Wait() != want {
+		t.Errorf("Wait() got = %+v, want %+v", p.Wait(), want)
+	}
+}
@@ -1,43 +1,51 @@
 package pool
 
 import (
-	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
-	"github.com/matperez/flibusta-parser/internal/work"
-	"gorm.io/gorm"
+	"context"
 	"log"
 )
 
-type Work struct {
-	ID     int
-	BookID int
+type workerIDKey struct{}
+
+//WorkerID returns the ID of the worker doing the job, zero outside of a handler
+func WorkerID(ctx context.Context) int {
+	id, _ := ctx.Value(workerIDKey{}).(int)
+	return id
 }
 
-type Worker struct {
-	ID            int
-	WorkerChannel chan chan Work
-	Channel       chan Work
-	End           chan bool
+type worker struct {
+	id   int
+	quit chan struct{}
 }
 
-// start worker
-func (w *Worker) Start(db *gorm.DB, flb flibusta2.Client) {
-	log.Printf("worker [%d] is starting", w.ID)
-	go func() {
-		for {
-			w.WorkerChannel <- w.Channel
-			select {
-			case job := <-w.Channel:
-				// do work
-				work.DoWork(db, flb, job.BookID, w.ID)
-			case <-w.End:
+func (w *worker) run(p *Pool) {
+	log.Printf("worker [%d] is starting", w.id)
+	defer log.Printf("worker [%d] is stopping", w.id)
+	ctx := context.WithValue(p.ctx, workerIDKey{}, w.id)
+	for {
+		// остановленный воркер не берет новых задач, даже если очередь не пуста
+		select {
+		case <-w.quit:
+			return
+		default:
+		}
+		select {
+		case <-w.quit:
+			return
+		case <-ctx.Done():
+			p.exited(w)
+			return
+		case job, ok := <-p.queue:
+			if !ok {
+				p.exited(w)
+				return
+			}
+			// задачи из очереди после отмены контекста не начинаются
+			if ctx.Err() != nil {
+				p.exited(w)
 				return
 			}
+			p.finish(p.handler(ctx, job))
 		}
-	}()
-}
-
-// end worker
-func (w *Worker) Stop() {
-	log.Printf("worker [%d] is stopping", w.ID)
-	w.End <- true
+	}
 }
@@ -0,0 +1,353 @@
+package sqldump
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//Row is a table row of a dump, NULL values are absent
+type Row map[string]string
+
+//Int returns the column value as an int, zero when it is absent or malformed
+func (r Row) Int(column string) int {
+	value, _ := strconv.Atoi(r[column])
+	return value
+}
+
+//Reader streams rows of INSERT statements from a mysqldump file without a MySQL server
+type Reader struct {
+	r       *bufio.Reader
+	columns map[string][]string
+}
+
+//NewReader creates a dump reader
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r:       bufio.NewReaderSize(r, 1<<20),
+		columns: map[string][]string{},
+	}
+}
+
+//gzipFile closes both the gzip reader and the underlying file
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+//Open opens a dump file, gzipped files are decompressed on the fly
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening the dump file")
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "error reading the gzipped dump file")
+	}
+	return &gzipFile{Reader: reader, file: file}, nil
+}
+
+//Each calls fn for every row inserted into the table
+func (d *Reader) Each(table string, fn func(Row) error) error {
+	for {
+		stmt, err := d.next()
+		if err != nil && err != io.EOF {
+			return errors.Wrap(err, "error reading the dump")
+		}
+		if stmt != "" {
+			if perr := d.handle(stmt, table, fn); perr != nil {
+				return perr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+//handle processes a single statement
+func (d *Reader) handle(stmt, table string, fn func(Row) error) error {
+	prefix := stmt
+	if len(prefix) > 32 {
+		prefix = prefix[:32]
+	}
+	upper := strings.ToUpper(prefix)
+	switch {
+	case strings.HasPrefix(upper, "CREATE TABLE"):
+		name, columns := parseCreateTable(stmt)
+		d.columns[name] = columns
+	case strings.HasPrefix(upper, "INSERT INTO"):
+		name, columns, values, err := parseInsert(stmt)
+		if err != nil {
+			return err
+		}
+		if name != table {
+			return nil
+		}
+		if columns == nil {
+			columns = d.columns[name]
+		}
+		if columns == nil {
+			return errors.Errorf("error reading the dump: columns of the table %s are unknown", name)
+		}
+		return parseTuples(values, func(tuple []*string) error {
+			row := Row{}
+			for i, value := range tuple {
+				if value != nil && i < len(columns) {
+					row[columns[i]] = *value
+				}
+			}
+			return fn(row)
+		})
+	}
+	return nil
+}
+
+//next reads the next statement up to a semicolon, comments are dropped
+func (d *Reader) next() (string, error) {
+	var buf bytes.Buffer
+	var quote byte
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return strings.TrimSpace(buf.String()), err
+		}
+		if quote != 0 {
+			buf.WriteByte(c)
+			if c == '\\' && quote != '`' {
+				escaped, err := d.r.ReadByte()
+				if err != nil {
+					return strings.TrimSpace(buf.String()), err
+				}
+				buf.WriteByte(escaped)
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+			buf.WriteByte(c)
+		case '#':
+			if err = d.skipLine(); err != nil {
+				return strings.TrimSpace(buf.String()), err
+			}
+		case '-':
+			if next, _ := d.r.Peek(1); len(next) == 1 && next[0] == '-' {
+				if err = d.skipLine(); err != nil {
+					return strings.TrimSpace(buf.String()), err
+				}
+				continue
+			}
+			buf.WriteByte(c)
+		case '/':
+			if next, _ := d.r.Peek(1); len(next) == 1 && next[0] == '*' {
+				if err = d.skipComment(); err != nil {
+					return strings.TrimSpace(buf.String()), err
+				}
+				continue
+			}
+			buf.WriteByte(c)
+		case ';':
+			return strings.TrimSpace(buf.String()), nil
+		default:
+			buf.WriteByte(c)
+		}
+	}
+}
+
+func (d *Reader) skipLine() error {
+	_, err := d.r.ReadString('\n')
+	return err
+}
+
+func (d *Reader) skipComment() error {
+	var prev byte
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if prev == '*' && c == '/' {
+			return nil
+		}
+		prev = c
+	}
+}
+
+//parseCreateTable fetches the table name and its column names
+func parseCreateTable(stmt string) (string, []string) {
+	var columns []string
+	start := strings.Index(stmt, "`")
+	if start < 0 {
+		return "", nil
+	}
+	name, _ := readQuotedName(stmt[start:])
+	for _, line := range strings.Split(stmt, "\n")[1:] {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "`") {
+			continue
+		}
+		column, _ := readQuotedName(line)
+		columns = append(columns, column)
+	}
+	return name, columns
+}
+
+//readQuotedName reads a backtick quoted name from the beginning of the string
+func readQuotedName(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "`") {
+		end := strings.IndexAny(s, " (")
+		if end < 0 {
+			return s, ""
+		}
+		return s[:end], s[end:]
+	}
+	end := strings.Index(s[1:], "`")
+	if end < 0 {
+		return s[1:], ""
+	}
+	return s[1 : end+1], s[end+2:]
+}
+
+//parseInsert splits an INSERT statement into the table name, the optional column list and the values
+func parseInsert(stmt string) (string, []string, string, error) {
+	rest := strings.TrimSpace(stmt[len("INSERT INTO"):])
+	name, rest := readQuotedName(rest)
+	rest = strings.TrimSpace(rest)
+	var columns []string
+	if strings.HasPrefix(rest, "(") {
+		end := strings.Index(rest, ")")
+		if end < 0 {
+			return "", nil, "", errors.Errorf("error parsing the insert into %s: unclosed column list", name)
+		}
+		for _, column := range strings.Split(rest[1:end], ",") {
+			column, _ = readQuotedName(column)
+			columns = append(columns, column)
+		}
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+	if !strings.HasPrefix(strings.ToUpper(rest), "VALUES") {
+		return "", nil, "", errors.Errorf("error parsing the insert into %s: values not found", name)
+	}
+	return name, columns, rest[len("VALUES"):], nil
+}
+
+//parseTuples calls fn for every "(...)" tuple of the values list
+func parseTuples(s string, fn func([]*string) error) error {
+	i := 0
+	skip := func() {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\n' || s[i] == '\r' || s[i] == '\t') {
+			i++
+		}
+	}
+	for {
+		skip()
+		if i < len(s) && s[i] == ',' {
+			i++
+			skip()
+		}
+		if i >= len(s) {
+			return nil
+		}
+		if s[i] != '(' {
+			return errors.Errorf("error parsing the values: unexpected %q at %d", s[i], i)
+		}
+		i++
+		var tuple []*string
+		for {
+			skip()
+			if i >= len(s) {
+				return errors.New("error parsing the values: unexpected end of the tuple")
+			}
+			if s[i] == '\'' {
+				value, next, err := unquote(s, i)
+				if err != nil {
+					return err
+				}
+				tuple = append(tuple, &value)
+				i = next
+			} else {
+				start := i
+				for i < len(s) && s[i] != ',' && s[i] != ')' {
+					i++
+				}
+				value := strings.TrimSpace(s[start:i])
+				if strings.EqualFold(value, "NULL") {
+					tuple = append(tuple, nil)
+				} else {
+					tuple = append(tuple, &value)
+				}
+			}
+			skip()
+			if i >= len(s) {
+				return errors.New("error parsing the values: unexpected end of the tuple")
+			}
+			if s[i] == ',' {
+				i++
+				continue
+			}
+			if s[i] == ')' {
+				i++
+				break
+			}
+			return errors.Errorf("error parsing the values: unexpected %q at %d", s[i], i)
+		}
+		if err := fn(tuple); err != nil {
+			return err
+		}
+	}
+}
+
+//unquote reads a single quoted MySQL string starting at i and returns it with the position after it
+func unquote(s string, i int) (string, int, error) {
+	var buf strings.Builder
+	for i++; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case '0':
+				buf.WriteByte(0)
+			case 'b':
+				buf.WriteByte('\b')
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case 'Z':
+				buf.WriteByte(0x1a)
+			default:
+				buf.WriteByte(s[i])
+			}
+		case c == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			buf.WriteByte('\'')
+			i++
+		case c == '\'':
+			return buf.String(), i + 1, nil
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", i, errors.New("error parsing the values: unclosed string")
+}
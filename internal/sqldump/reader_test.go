@@ -0,0 +1,49 @@
+package sqldump
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDump = `-- MySQL dump 10.13
+/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;
+DROP TABLE IF EXISTS ` + "`libavtorname`" + `;
+CREATE TABLE ` + "`libavtorname`" + ` (
+  ` + "`AvtorId`" + ` int(10) unsigned NOT NULL AUTO_INCREMENT,
+  ` + "`FirstName`" + ` varchar(99) NOT NULL DEFAULT '',
+  ` + "`LastName`" + ` varchar(99) NOT NULL DEFAULT '',
+  ` + "`NickName`" + ` varchar(33) DEFAULT NULL,
+  PRIMARY KEY (` + "`AvtorId`" + `)
+) ENGINE=MyISAM DEFAULT CHARSET=utf8;
+LOCK TABLES ` + "`libavtorname`" + ` WRITE;
+INSERT INTO ` + "`libavtorname`" + ` VALUES (1,'Кир','Булычев',NULL),(2,'O\'Brien','Flann; \\ ok',''),(3,'It''s','Line\nBreak','x');
+INSERT INTO ` + "`other`" + ` VALUES (1,'skipped');
+INSERT INTO ` + "`libavtorname`" + ` (` + "`AvtorId`" + `,` + "`LastName`" + `) VALUES (4,'Толстой');
+UNLOCK TABLES;
+`
+
+func TestReader_Each(t *testing.T) {
+	t.Parallel()
+	want := []Row{
+		{"AvtorId": "1", "FirstName": "Кир", "LastName": "Булычев"},
+		{"AvtorId": "2", "FirstName": "O'Brien", "LastName": "Flann; \\ ok", "NickName": ""},
+		{"AvtorId": "3", "FirstName": "It's", "LastName": "Line\nBreak", "NickName": "x"},
+		{"AvtorId": "4", "LastName": "Толстой"},
+	}
+	var got []Row
+	err := NewReader(strings.NewReader(testDump)).Each("libavtorname", func(row Row) error {
+		got = append(got, row)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Each() error = %v", err)
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Each() got rows = %v, want rows %v", got, want)
+	}
+	if got[0].Int("AvtorId") != 1 {
+		t.Errorf("Int() got = %v, want %v", got[0].Int("AvtorId"), 1)
+	}
+}
@@ -3,28 +3,157 @@ package storage
 import "time"
 
 type Book struct {
+	ID                  uint `gorm:"primarykey"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Title               string `gorm:"index:,class:FULLTEXT;type:VARCHAR(255);not null;required"`
+	ReadCount           uint   `gorm:"index"`
+	RecommendationCount uint   `gorm:"index"`
+	FileRating          uint
+	Annotation          *string       `gorm:"type:TEXT;index:,class:FULLTEXT"`
+	Contributors        []*BookAuthor `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Genres              []*Genre      `gorm:"many2many:book_genres;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Format              string        `gorm:"index;type:VARCHAR(16)"`
+	Size                uint64
+	Pages               uint
+	Year                uint          `gorm:"index"`
+	AddedAt             *time.Time    `gorm:"index"`
+	Status              string        `gorm:"index;type:VARCHAR(16);not null;default:active"`
+	ReplacedBy          *uint         `gorm:"index"`
+	Cover               *string       `gorm:"type:VARCHAR(255)"`
+	Lang                string        `gorm:"index;type:VARCHAR(8)"`
+	Series              []*BookSeries `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Reviews             []*Review     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+type BookFile struct {
+	BookID    uint   `gorm:"primarykey;autoIncrement:false"`
+	Format    string `gorm:"primarykey;type:VARCHAR(16)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Path      string `gorm:"type:VARCHAR(1024);not null"`
+	Size      uint64
+	Sha256    string `gorm:"index;type:CHAR(64);not null"`
+	Book      *Book  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+type CrawlAttempt struct {
+	BookID          uint `gorm:"primarykey;autoIncrement:false"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Status          string `gorm:"index;type:VARCHAR(16);not null"`
+	ErrorClass      string `gorm:"index;type:VARCHAR(32)"`
+	Error           string `gorm:"type:TEXT"`
+	HTTPStatus      int
+	Attempts        uint      `gorm:"not null;default:0"`
+	LastAttemptedAt time.Time `gorm:"index"`
+}
+
+type BookRevision struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	BookID    uint      `gorm:"index;not null"`
+	Book      *Book     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Snapshot  string    `gorm:"type:TEXT;not null"`
+	Changes   string    `gorm:"type:TEXT"`
+}
+
+type ReadCountSample struct {
+	ID                  uint      `gorm:"primarykey"`
+	BookID              uint      `gorm:"index:idx_read_count_samples_book_observed,priority:1;not null"`
+	Book                *Book     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	ReadCount           uint      `gorm:"not null"`
+	RecommendationCount uint      `gorm:"not null;default:0"`
+	FileRating          uint      `gorm:"not null;default:0"`
+	ObservedAt          time.Time `gorm:"index:idx_read_count_samples_book_observed,priority:2;index;not null"`
+}
+
+type Review struct {
 	ID         uint `gorm:"primarykey"`
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
-	Title      string    `gorm:"index:,class:FULLTEXT;type:VARCHAR(255);not null;required"`
-	ReadCount  uint      `gorm:"index"`
-	Annotation *string   `gorm:"type:TEXT;index:,class:FULLTEXT"`
-	Authors    []*Author `gorm:"many2many:book_authors;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	Genres     []*Genre  `gorm:"many2many:book_genres;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	BookID     uint       `gorm:"uniqueIndex:idx_reviews_book_user,priority:1;not null"`
+	UserID     uint       `gorm:"uniqueIndex:idx_reviews_book_user,priority:2;index;not null"`
+	UserName   string     `gorm:"type:VARCHAR(255);not null"`
+	ReviewedAt *time.Time `gorm:"index"`
+	Rating     uint       `gorm:"index"`
+	Text       string     `gorm:"type:TEXT"`
 }
 
-type Author struct {
+type Series struct {
 	ID        uint `gorm:"primarykey"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Name      string  `gorm:"index:,class:FULLTEXT;required;not null;"`
-	Books     []*Book `gorm:"many2many:book_authors;"`
+	Title     string        `gorm:"index:,class:FULLTEXT;type:VARCHAR(255);not null;required"`
+	Books     []*BookSeries `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+type BookSeries struct {
+	BookID   uint `gorm:"primarykey;autoIncrement:false"`
+	SeriesID uint `gorm:"primarykey;autoIncrement:false"`
+	Number   uint
+	Series   *Series
+}
+
+type Cover struct {
+	BookID    uint `gorm:"primarykey;autoIncrement:false"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Hash      string `gorm:"index;type:CHAR(64);not null"`
+	MimeType  string `gorm:"type:VARCHAR(32)"`
+	Width     uint
+	Height    uint
+	Size      uint
+	Book      *Book `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+type Author struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Name         string  `gorm:"index:,class:FULLTEXT;required;not null;"`
+	FirstName    string  `gorm:"type:VARCHAR(255)"`
+	MiddleName   string  `gorm:"type:VARCHAR(255)"`
+	LastName     string  `gorm:"index;type:VARCHAR(255)"`
+	Bio          *string `gorm:"type:TEXT"`
+	ParsedAt     *time.Time
+	Aliases      []*Author            `gorm:"many2many:author_aliases;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Bibliography []*BibliographyEntry `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Books        []*BookAuthor        `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+type BookAuthor struct {
+	BookID   uint   `gorm:"primarykey;autoIncrement:false"`
+	AuthorID uint   `gorm:"primarykey;autoIncrement:false"`
+	Role     string `gorm:"index;type:VARCHAR(16);not null;default:author"`
+	Author   *Author
+}
+
+type BibliographyEntry struct {
+	AuthorID    uint   `gorm:"primarykey;autoIncrement:false"`
+	BookID      uint   `gorm:"primarykey;autoIncrement:false"`
+	Role        string `gorm:"primarykey;type:VARCHAR(16)"`
+	Position    uint
+	Title       string  `gorm:"type:VARCHAR(255);not null"`
+	SeriesID    *uint   `gorm:"index"`
+	SeriesTitle *string `gorm:"type:VARCHAR(255)"`
 }
 
 type Genre struct {
 	ID        uint `gorm:"primarykey"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Title     string  `gorm:"required;not null;"`
-	Books     []*Book `gorm:"many2many:book_genres;"`
+	Title     string      `gorm:"required;not null;"`
+	Code      *string     `gorm:"uniqueIndex;type:VARCHAR(64)"`
+	GroupCode *string     `gorm:"index;type:VARCHAR(64)"`
+	Group     *GenreGroup `gorm:"foreignKey:GroupCode;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	Books     []*Book     `gorm:"many2many:book_genres;"`
+}
+
+type GenreGroup struct {
+	Code      string `gorm:"primarykey;type:VARCHAR(64)"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Title     string   `gorm:"required;not null;"`
+	Genres    []*Genre `gorm:"foreignKey:GroupCode"`
 }
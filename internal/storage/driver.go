@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+//Open connects to the database with the driver. The FULLTEXT indexes of the models are created
+//as is on MySQL, as GIN tsvector indexes on PostgreSQL and as FTS5 tables on SQLite.
+func Open(driver, dsn string, config *gorm.Config) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch driver {
+	case DriverMySQL:
+		dialector = mysql.Open(dsn)
+	case DriverPostgres:
+		dialector = postgres.Open(dsn)
+	case DriverSQLite:
+		dialector = sqlite.Open(dsn)
+	default:
+		return nil, errors.Errorf("error opening the database: unknown driver %s", driver)
+	}
+	db, err := gorm.Open(fulltextDialector{Dialector: dialector}, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening the database")
+	}
+	return db, nil
+}
+
+//Migrate creates or updates the tables of all the models
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&Book{},
+		&Author{},
+		&Genre{},
+		&Cover{},
+		&GenreGroup{},
+		&BibliographyEntry{},
+		&Series{},
+		&BookSeries{},
+		&BookAuthor{},
+		&BookFile{},
+		&CrawlAttempt{},
+		&BookRevision{},
+		&ReadCountSample{},
+		&Review{},
+	)
+}
+
+//fulltextDialector creates the FULLTEXT indexes the way the database supports
+type fulltextDialector struct {
+	gorm.Dialector
+}
+
+func (d fulltextDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return fulltextMigrator{Migrator: d.Dialector.Migrator(db), db: db}
+}
+
+type fulltextMigrator struct {
+	gorm.Migrator
+	db *gorm.DB
+}
+
+func (m fulltextMigrator) CreateIndex(value interface{}, name string) error {
+	stmt := &gorm.Statement{DB: m.db}
+	if err := stmt.Parse(value); err != nil {
+		return err
+	}
+	idx := stmt.Schema.LookIndex(name)
+	if idx == nil || idx.Class != "FULLTEXT" {
+		return m.Migrator.CreateIndex(value, name)
+	}
+	var columns []string
+	for _, field := range idx.Fields {
+		columns = append(columns, field.DBName)
+	}
+	table := stmt.Schema.Table
+	switch m.db.Dialector.Name() {
+	case DriverPostgres:
+		// выражение индекса должно совпадать с выражением в запросе, иначе индекс не используется
+		var parts []string
+		for _, column := range columns {
+			parts = append(parts, fmt.Sprintf("coalesce(%q, '')", column))
+		}
+		return m.db.Exec(fmt.Sprintf(
+			"CREATE INDEX IF NOT EXISTS %q ON %q USING GIN (to_tsvector('simple', %s))",
+			name, table, strings.Join(parts, " || ' ' || "),
+		)).Error
+	case DriverSQLite:
+		return createFTS5Table(m.db, table, name, columns)
+	}
+	return m.Migrator.CreateIndex(value, name)
+}
+
+//createFTS5Table creates an external content FTS5 table kept in sync with the table by triggers.
+//SQLite built without FTS5 (the sqlite_fts5 build tag) only gets a warning.
+func createFTS5Table(db *gorm.DB, table, name string, columns []string) error {
+	fts := name + "_fts"
+	quoted := make([]string, len(columns))
+	newValues := make([]string, len(columns))
+	oldValues := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = fmt.Sprintf("%q", column)
+		newValues[i] = "new." + quoted[i]
+		oldValues[i] = "old." + quoted[i]
+	}
+	list := strings.Join(quoted, ", ")
+	err := db.Exec(fmt.Sprintf(
+		"CREATE VIRTUAL TABLE IF NOT EXISTS %q USING fts5(%s, content='%s', content_rowid='id')",
+		fts, list, table,
+	)).Error
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module: fts5") {
+			log.Printf("sqlite is built without fts5, skipping the full text index %s", name)
+			return nil
+		}
+		return err
+	}
+	insert := fmt.Sprintf("INSERT INTO %q(rowid, %s) VALUES (new.id, %s);", fts, list, strings.Join(newValues, ", "))
+	remove := fmt.Sprintf("INSERT INTO %q(%q, rowid, %s) VALUES ('delete', old.id, %s);", fts, fts, list, strings.Join(oldValues, ", "))
+	triggers := map[string]string{
+		"ai": "AFTER INSERT ON %q BEGIN " + insert + " END",
+		"ad": "AFTER DELETE ON %q BEGIN " + remove + " END",
+		"au": "AFTER UPDATE ON %q BEGIN " + remove + " " + insert + " END",
+	}
+	for _, suffix := range []string{"ai", "ad", "au"} {
+		err = db.Exec(fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %q "+triggers[suffix], fts+"_"+suffix, table)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//openTestDB opens a migrated SQLite database in a temporary directory removed after the test
+func openTestDB(t *testing.T) *gorm.DB {
+	dir, err := ioutil.TempDir("", "flibusta-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	db, err := Open(DriverSQLite, filepath.Join(dir, "flibusta.db"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err = Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	return db
+}
+
+func TestMigrate_sqlite(t *testing.T) {
+	t.Parallel()
+	db := openTestDB(t)
+	// повторная миграция не должна падать на уже созданных индексах
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if err := db.Create(&Book{ID: 9, Title: "Пикник на обочине"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !db.Migrator().HasTable("idx_books_title_fts") {
+		t.Skip("sqlite is built without fts5, run the tests with -tags sqlite_fts5")
+	}
+	var ids []uint
+	err := db.Raw(`SELECT rowid FROM idx_books_title_fts WHERE idx_books_title_fts MATCH ?`, "обочине").Scan(&ids).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint{9}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("full text search got = %v, want %v", ids, want)
+	}
+}
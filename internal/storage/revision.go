@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"reflect"
+	"strings"
+)
+
+//FieldChange is a field of the book changed between two crawls
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+//DiffStates returns the fields of the book state that differ, in the order of BookState fields
+func DiffStates(old, new BookState) []FieldChange {
+	var changes []FieldChange
+	oldValue := reflect.ValueOf(old)
+	newValue := reflect.ValueOf(new)
+	for i := 0; i < oldValue.NumField(); i++ {
+		before := formatStateField(oldValue.Field(i))
+		after := formatStateField(newValue.Field(i))
+		if before != after {
+			changes = append(changes, FieldChange{Field: oldValue.Type().Field(i).Name, Old: before, New: after})
+		}
+	}
+	return changes
+}
+
+func formatStateField(v reflect.Value) string {
+	if v.Kind() == reflect.Slice {
+		return strings.Join(v.Interface().([]string), ", ")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+//FieldChanges decodes the changes of the revision, the first revision of the book has none
+func (r *BookRevision) FieldChanges() ([]FieldChange, error) {
+	var changes []FieldChange
+	if r.Changes == "" {
+		return changes, nil
+	}
+	err := json.Unmarshal([]byte(r.Changes), &changes)
+	return changes, err
+}
+
+//recordRevision stores the new state of the book with the changes since the stored one, nil for a new book
+func recordRevision(tx *gorm.DB, bookID uint, stored *BookState, state BookState) error {
+	snapshot, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	revision := &BookRevision{BookID: bookID, Snapshot: string(snapshot)}
+	if stored != nil {
+		changes, err := json.Marshal(DiffStates(*stored, state))
+		if err != nil {
+			return err
+		}
+		revision.Changes = string(changes)
+	}
+	return tx.Create(revision).Error
+}
+
+//BookHistory returns the revisions of the book from the oldest one
+func BookHistory(db *gorm.DB, bookID uint) ([]*BookRevision, error) {
+	var revisions []*BookRevision
+	err := db.Where("book_id = ?", bookID).Order("created_at").Order("id").Find(&revisions).Error
+	return revisions, err
+}
@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"sort"
+)
+
+//UpsertResult tells what happened to the stored book
+type UpsertResult string
+
+const (
+	UpsertCreated   UpsertResult = "created"
+	UpsertChanged   UpsertResult = "changed"
+	UpsertUnchanged UpsertResult = "unchanged"
+)
+
+//BookState is the comparable part of the book: the fields and the keys of the associations
+type BookState struct {
+	Title               string
+	ReadCount           uint
+	RecommendationCount uint
+	FileRating          uint
+	Annotation          string
+	Format              string
+	Size                uint64
+	Pages               uint
+	Year                uint
+	AddedAt             string
+	Status              string
+	ReplacedBy          uint
+	Cover               string
+	Contributors        []string
+	Genres              []string
+	Series              []string
+}
+
+//StateOf returns the state of the book loaded with its contributors, genres and series
+func StateOf(b *Book) BookState {
+	state := BookState{
+		Title:               b.Title,
+		ReadCount:           b.ReadCount,
+		RecommendationCount: b.RecommendationCount,
+		FileRating:          b.FileRating,
+		Format:              b.Format,
+		Size:                b.Size,
+		Pages:               b.Pages,
+		Year:                b.Year,
+		Status:              b.Status,
+	}
+	// пустые значения сохраняются как значения по умолчанию из тегов модели
+	if state.Status == "" {
+		state.Status = "active"
+	}
+	if b.Annotation != nil {
+		state.Annotation = *b.Annotation
+	}
+	if b.AddedAt != nil {
+		// на странице только дата, время и зона зависят от базы
+		state.AddedAt = b.AddedAt.Format("2006-01-02")
+	}
+	if b.ReplacedBy != nil {
+		state.ReplacedBy = *b.ReplacedBy
+	}
+	if b.Cover != nil {
+		state.Cover = *b.Cover
+	}
+	for _, c := range b.Contributors {
+		role := c.Role
+		if role == "" {
+			role = "author"
+		}
+		state.Contributors = append(state.Contributors, fmt.Sprintf("%d:%s", c.AuthorID, role))
+	}
+	for _, g := range b.Genres {
+		state.Genres = append(state.Genres, fmt.Sprint(g.ID))
+	}
+	for _, s := range b.Series {
+		state.Series = append(state.Series, fmt.Sprintf("%d:%d", s.SeriesID, s.Number))
+	}
+	sort.Strings(state.Contributors)
+	sort.Strings(state.Genres)
+	sort.Strings(state.Series)
+	return state
+}
+
+//bookColumns are updated when the book is stored again, the language only comes from the FB2 files
+var bookColumns = []string{"title", "read_count", "recommendation_count", "file_rating", "annotation", "format", "size", "pages", "year", "added_at", "status", "replaced_by", "cover", "updated_at"}
+
+//UpsertBook stores the book in one transaction: the authors, genres and series are upserted by ID
+//with their names updated, the book row is upserted, its association sets are replaced
+//and a revision with the changes is recorded. Nothing but the names is written when the book is unchanged.
+func UpsertBook(db *gorm.DB, book *Book) (UpsertResult, error) {
+	var result UpsertResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var stored []*Book
+		err := tx.Preload("Contributors").Preload("Genres").Preload("Series").Where("id = ?", book.ID).Limit(1).Find(&stored).Error
+		if err != nil {
+			return err
+		}
+		state := StateOf(book)
+		var storedState *BookState
+		result = UpsertCreated
+		if len(stored) > 0 {
+			s := StateOf(stored[0])
+			storedState = &s
+			result = UpsertChanged
+			if reflect.DeepEqual(s, state) {
+				result = UpsertUnchanged
+			}
+		}
+		if err = upsertReferences(tx, book); err != nil {
+			return err
+		}
+		if result == UpsertUnchanged {
+			return nil
+		}
+		columns := bookColumns
+		if book.Lang != "" {
+			columns = append(columns[:len(columns):len(columns)], "lang")
+		}
+		err = tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns(columns),
+		}).Create(book).Error
+		if err != nil {
+			return err
+		}
+		if err = replaceAssociations(tx, book); err != nil {
+			return err
+		}
+		return recordRevision(tx, book.ID, storedState, state)
+	})
+	return result, err
+}
+
+//upsertReferences stores the authors, genres and series the book refers to. The rows are written
+//in the order of their IDs, so the concurrent transactions lock them in the same order and do not deadlock.
+func upsertReferences(tx *gorm.DB, book *Book) error {
+	var authors []*Author
+	for _, c := range book.Contributors {
+		if c.Author != nil {
+			authors = append(authors, c.Author)
+		}
+	}
+	sort.Slice(authors, func(i, j int) bool { return authors[i].ID < authors[j].ID })
+	if len(authors) > 0 {
+		err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "updated_at"}),
+		}).Create(&authors).Error
+		if err != nil {
+			return err
+		}
+	}
+	genres := append([]*Genre(nil), book.Genres...)
+	sort.Slice(genres, func(i, j int) bool { return genres[i].ID < genres[j].ID })
+	if len(genres) > 0 {
+		err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"title", "code", "group_code", "updated_at"}),
+		}).Create(&genres).Error
+		if err != nil {
+			return err
+		}
+	}
+	var series []*Series
+	for _, s := range book.Series {
+		if s.Series != nil {
+			series = append(series, s.Series)
+		}
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].ID < series[j].ID })
+	if len(series) > 0 {
+		err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"title", "updated_at"}),
+		}).Create(&series).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//replaceAssociations replaces the contributors, genres and series of the book with its current ones
+func replaceAssociations(tx *gorm.DB, book *Book) error {
+	if err := tx.Where("book_id = ?", book.ID).Delete(&BookAuthor{}).Error; err != nil {
+		return err
+	}
+	if len(book.Contributors) > 0 {
+		for _, c := range book.Contributors {
+			c.BookID = book.ID
+		}
+		if err := tx.Omit(clause.Associations).Create(&book.Contributors).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Table("book_genres").Where("book_id = ?", book.ID).Delete(map[string]interface{}{}).Error; err != nil {
+		return err
+	}
+	var links []map[string]interface{}
+	for _, g := range book.Genres {
+		links = append(links, map[string]interface{}{"book_id": book.ID, "genre_id": g.ID})
+	}
+	if len(links) > 0 {
+		if err := tx.Table("book_genres").Create(&links).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("book_id = ?", book.ID).Delete(&BookSeries{}).Error; err != nil {
+		return err
+	}
+	if len(book.Series) > 0 {
+		for _, s := range book.Series {
+			s.BookID = book.ID
+		}
+		if err := tx.Omit(clause.Associations).Create(&book.Series).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testBook(title string, authors map[uint]string, genres map[uint]string) *Book {
+	book := &Book{ID: 9, Title: title}
+	for id, name := range authors {
+		book.Contributors = append(book.Contributors, &BookAuthor{AuthorID: id, Role: "author", Author: &Author{ID: id, Name: name}})
+	}
+	for id, name := range genres {
+		book.Genres = append(book.Genres, &Genre{ID: id, Title: name})
+	}
+	return book
+}
+
+func TestUpsertBook(t *testing.T) {
+	db := openTestDB(t)
+	tests := []struct {
+		name    string
+		book    *Book
+		want    UpsertResult
+		authors []string
+		genres  []string
+	}{
+		{
+			name:    "new book",
+			book:    testBook("Пикник на обочине", map[uint]string{1: "Стругацкий", 2: "Стругацкий Б."}, map[uint]string{5: "Фантастика"}),
+			want:    UpsertCreated,
+			authors: []string{"Стругацкий", "Стругацкий Б."},
+			genres:  []string{"Фантастика"},
+		},
+		{
+			name:    "same book",
+			book:    testBook("Пикник на обочине", map[uint]string{1: "Стругацкий", 2: "Стругацкий Б."}, map[uint]string{5: "Фантастика"}),
+			want:    UpsertUnchanged,
+			authors: []string{"Стругацкий", "Стругацкий Б."},
+			genres:  []string{"Фантастика"},
+		},
+		{
+			name:    "renamed author",
+			book:    testBook("Пикник на обочине", map[uint]string{1: "Стругацкий А.", 2: "Стругацкий Б."}, map[uint]string{5: "Фантастика"}),
+			want:    UpsertUnchanged,
+			authors: []string{"Стругацкий А.", "Стругацкий Б."},
+			genres:  []string{"Фантастика"},
+		},
+		{
+			name:    "stale links",
+			book:    testBook("Пикник", map[uint]string{1: "Стругацкий А."}, map[uint]string{6: "Социальная фантастика"}),
+			want:    UpsertChanged,
+			authors: []string{"Стругацкий А."},
+			genres:  []string{"Социальная фантастика"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UpsertBook(db, tt.book)
+			if err != nil {
+				t.Fatalf("UpsertBook() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("UpsertBook() got = %v, want %v", got, tt.want)
+			}
+			var authors, genres []string
+			db.Table("authors").Joins("JOIN book_authors ON book_authors.author_id = authors.id").
+				Where("book_authors.book_id = ?", 9).Order("authors.name").Pluck("authors.name", &authors)
+			db.Table("genres").Joins("JOIN book_genres ON book_genres.genre_id = genres.id").
+				Where("book_genres.book_id = ?", 9).Order("genres.title").Pluck("genres.title", &genres)
+			if !reflect.DeepEqual(authors, tt.authors) {
+				t.Errorf("authors got = %v, want %v", authors, tt.authors)
+			}
+			if !reflect.DeepEqual(genres, tt.genres) {
+				t.Errorf("genres got = %v, want %v", genres, tt.genres)
+			}
+		})
+	}
+
+	revisions, err := BookHistory(db, 9)
+	if err != nil {
+		t.Fatalf("BookHistory() error = %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("BookHistory() got %d revisions, want %d", len(revisions), 2)
+	}
+	changes, err := revisions[1].FieldChanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FieldChange{
+		{Field: "Title", Old: "Пикник на обочине", New: "Пикник"},
+		{Field: "Contributors", Old: "1:author, 2:author", New: "1:author"},
+		{Field: "Genres", Old: "5", New: "6"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("FieldChanges() got = %+v, want %+v", changes, want)
+	}
+}
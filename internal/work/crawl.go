@@ -0,0 +1,90 @@
+package work
+
+import (
+	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
+	storage2 "github.com/matperez/flibusta-parser/internal/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+//CrawlStatus is the outcome of the last attempt to parse a book page
+type CrawlStatus string
+
+const (
+	//CrawlDone means the book is stored
+	CrawlDone CrawlStatus = "done"
+	//CrawlMissing means the page does not exist or is blocked, retrying will not help
+	CrawlMissing CrawlStatus = "missing"
+	//CrawlFailed means the attempt failed and is worth repeating
+	CrawlFailed CrawlStatus = "failed"
+)
+
+//crawlStatusOf maps the fetch error to the crawl status
+func crawlStatusOf(err error) CrawlStatus {
+	if err == nil {
+		return CrawlDone
+	}
+	switch flibusta2.ClassOf(err) {
+	case flibusta2.ErrNotFound, flibusta2.ErrBlocked:
+		return CrawlMissing
+	}
+	return CrawlFailed
+}
+
+//RecordCrawlAttempt stores the outcome of an attempt to parse the book page and counts the attempts
+func RecordCrawlAttempt(db *gorm.DB, bookId int, err error) error {
+	now := time.Now()
+	attempt := &storage2.CrawlAttempt{
+		BookID:          uint(bookId),
+		Status:          string(crawlStatusOf(err)),
+		Attempts:        1,
+		LastAttemptedAt: now,
+	}
+	if err != nil {
+		attempt.ErrorClass = string(flibusta2.ClassOf(err))
+		attempt.Error = err.Error()
+		attempt.HTTPStatus = flibusta2.StatusCodeOf(err)
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "book_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"status":            attempt.Status,
+			"error_class":       attempt.ErrorClass,
+			"error":             attempt.Error,
+			"http_status":       attempt.HTTPStatus,
+			"attempts":          gorm.Expr("crawl_attempts.attempts + 1"),
+			"last_attempted_at": now,
+			"updated_at":        now,
+		}),
+	}).Create(attempt).Error
+}
+
+func recordCrawlAttempt(db *gorm.DB, workerId, bookId int, err error) {
+	if err = RecordCrawlAttempt(db, bookId, err); err != nil {
+		log.Printf("worker [%d] failed to record the crawl attempt of the book [%d]: %s", workerId, bookId, err.Error())
+	}
+}
+
+//PendingJobs returns the book IDs of the range which are not done yet: the failed and never tried ones
+func PendingJobs(db *gorm.DB, from, to int) ([]int, error) {
+	var completed []int
+	err := db.Model(&storage2.CrawlAttempt{}).
+		Where("book_id >= ? AND book_id < ? AND status IN ?", from, to, []string{string(CrawlDone), string(CrawlMissing)}).
+		Pluck("book_id", &completed).Error
+	if err != nil {
+		return nil, err
+	}
+	skip := make(map[int]bool, len(completed))
+	for _, id := range completed {
+		skip[id] = true
+	}
+	var jobs []int
+	for _, id := range CreateJobs(from, to) {
+		if !skip[id] {
+			jobs = append(jobs, id)
+		}
+	}
+	return jobs, nil
+}
@@ -0,0 +1,31 @@
+package work
+
+import (
+	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
+	"github.com/pkg/errors"
+	"testing"
+)
+
+func Test_crawlStatusOf(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		err  error
+		want CrawlStatus
+	}{
+		{name: "Stored", err: nil, want: CrawlDone},
+		{name: "Not found", err: &flibusta2.Error{Class: flibusta2.ErrNotFound, Err: errors.New("not found")}, want: CrawlMissing},
+		{name: "Blocked", err: &flibusta2.Error{Class: flibusta2.ErrBlocked, Err: errors.New("blocked")}, want: CrawlMissing},
+		{name: "Wrapped transient", err: errors.Wrap(&flibusta2.Error{Class: flibusta2.ErrTransient, Err: errors.New("timeout")}, "error fetching"), want: CrawlFailed},
+		{name: "Database", err: errors.New("deadlock"), want: CrawlFailed},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := crawlStatusOf(tt.err); got != tt.want {
+				t.Errorf("crawlStatusOf() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package work
+
+import (
+	"archive/zip"
+	"context"
+	"github.com/matperez/flibusta-parser/internal/fb2"
+	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
+	storage2 "github.com/matperez/flibusta-parser/internal/storage"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//dailyFilePattern matches the book ID in the file names of the daily archives like 812345.fb2
+var dailyFilePattern = regexp.MustCompile(`^(\d+)\.fb2$`)
+
+//FetchDailyArchives downloads the daily archives missing in the directory
+func FetchDailyArchives(ctx context.Context, flb flibusta2.Client, dir string) error {
+	names, err := flb.GetDailyArchives(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if _, err = os.Stat(path); err == nil {
+			continue
+		}
+		log.Printf("downloading the daily archive %s", name)
+		tmp, err := ioutil.TempFile(dir, name+".*")
+		if err != nil {
+			return errors.Wrap(err, "error creating a temporary archive file")
+		}
+		err = flb.DownloadDailyArchive(ctx, name, tmp)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	return nil
+}
+
+//ImportDailyArchive upserts the books of the FB2 files in a daily archive and returns their count
+func ImportDailyArchive(db *gorm.DB, path string) (int, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, errors.Wrap(err, "error opening the daily archive")
+	}
+	defer archive.Close()
+	var count int
+	for _, file := range archive.File {
+		match := dailyFilePattern.FindStringSubmatch(filepath.Base(file.Name))
+		if match == nil {
+			continue
+		}
+		id, _ := strconv.Atoi(match[1])
+		info, err := readDailyFile(file)
+		if err != nil {
+			log.Printf("failed to read %s from %s: %s", file.Name, path, err.Error())
+			continue
+		}
+		if err = StoreDailyBook(db, id, int64(file.UncompressedSize64), info); err != nil {
+			return count, errors.Wrapf(err, "error storing the book [%d]", id)
+		}
+		count++
+	}
+	return count, nil
+}
+
+func readDailyFile(file *zip.File) (*fb2.TitleInfo, error) {
+	r, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return fb2.ReadTitleInfo(r)
+}
+
+//StoreDailyBook upserts the book by its ID and links it to the known authors, genres and series.
+//FB2 files carry no site IDs, so authors are matched by the name parts, series by the title and genres by code.
+//The size and the year of a book already parsed from its page are kept.
+//The people and sequences matching none or several stored ones are logged and skipped.
+func StoreDailyBook(db *gorm.DB, id int, size int64, info *fb2.TitleInfo) error {
+	book := &storage2.Book{
+		ID:     uint(id),
+		Title:  info.BookTitle,
+		Format: "fb2",
+		Size:   uint64(size),
+		Year:   uint(info.Year()),
+		Lang:   info.Lang,
+		Status: string(flibusta2.StatusActive),
+	}
+	// размер файла и год издания со страницы книги точнее: в архиве несжатый FB2, а в title-info дата написания,
+	// поэтому они заполняются, только если еще пусты
+	columns := []string{"title", "format", "lang", "updated_at"}
+	if annotation := info.AnnotationHTML(); annotation != "" {
+		book.Annotation = &annotation
+		columns = append(columns, "annotation")
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns(columns),
+		}).Create(book).Error
+		if err != nil {
+			return err
+		}
+		if book.Size > 0 {
+			if err = tx.Model(&storage2.Book{}).Where("id = ? AND size = 0", id).Update("size", book.Size).Error; err != nil {
+				return err
+			}
+		}
+		if book.Year > 0 {
+			if err = tx.Model(&storage2.Book{}).Where("id = ? AND year = 0", id).Update("year", book.Year).Error; err != nil {
+				return err
+			}
+		}
+		var contributors []*storage2.BookAuthor
+		credits := []struct {
+			role   flibusta2.Role
+			people []fb2.Person
+		}{
+			{role: flibusta2.RoleAuthor, people: info.Authors},
+			{role: flibusta2.RoleTranslator, people: info.Translators},
+		}
+		for _, credit := range credits {
+			for _, person := range credit.people {
+				authorID, err := findDailyAuthor(tx, id, person)
+				if err != nil {
+					return err
+				}
+				if authorID != 0 {
+					contributors = append(contributors, &storage2.BookAuthor{BookID: book.ID, AuthorID: authorID, Role: string(credit.role)})
+				}
+			}
+		}
+		if len(contributors) > 0 {
+			if err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&contributors).Error; err != nil {
+				return err
+			}
+		}
+		if len(info.Genres) > 0 {
+			var genres []uint
+			if err = tx.Model(&storage2.Genre{}).Where("code IN ?", info.Genres).Pluck("id", &genres).Error; err != nil {
+				return err
+			}
+			var links []map[string]interface{}
+			for _, genreID := range genres {
+				links = append(links, map[string]interface{}{"book_id": book.ID, "genre_id": genreID})
+			}
+			if len(links) > 0 {
+				if err = tx.Table("book_genres").Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error; err != nil {
+					return err
+				}
+			}
+		}
+		for _, sequence := range info.Sequences {
+			var series []uint
+			if err = tx.Model(&storage2.Series{}).Where("title = ?", sequence.Name).Limit(2).Pluck("id", &series).Error; err != nil {
+				return err
+			}
+			if len(series) != 1 {
+				log.Printf("daily book [%d]: %d series match the sequence %q, skipping it", id, len(series), sequence.Name)
+				continue
+			}
+			number, _ := strconv.Atoi(sequence.Number)
+			err = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "book_id"}, {Name: "series_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"number"}),
+			}).Create(&storage2.BookSeries{BookID: book.ID, SeriesID: series[0], Number: uint(number)}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//findDailyAuthor returns the ID of the only stored author matching the person of the FB2 file or zero.
+//The authors stored without the name parts, like the ones from the book pages, are matched by the full name.
+func findDailyAuthor(tx *gorm.DB, bookID int, person fb2.Person) (uint, error) {
+	fullName := joinName(person.FirstName, person.MiddleName, person.LastName)
+	if fullName == "" {
+		fullName = strings.TrimSpace(person.Nickname)
+	}
+	if fullName == "" {
+		return 0, nil
+	}
+	// сначала ищем по имени, отчеству и фамилии, затем среди авторов без отчества и без частей имени:
+	// однофамильцы с другим отчеством - разные люди
+	var ids []uint
+	if person.LastName != "" && person.MiddleName != "" {
+		err := tx.Model(&storage2.Author{}).
+			Where("first_name = ? AND middle_name = ? AND last_name = ?", person.FirstName, person.MiddleName, person.LastName).
+			Limit(2).Pluck("id", &ids).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	if len(ids) == 0 {
+		conditions := tx.Session(&gorm.Session{NewDB: true}).
+			Where("last_name = '' AND name IN ?", []string{fullName, joinName(person.FirstName, person.LastName)})
+		if person.LastName != "" {
+			conditions = conditions.Or("first_name = ? AND middle_name = '' AND last_name = ?", person.FirstName, person.LastName)
+		}
+		if err := tx.Model(&storage2.Author{}).Where(conditions).Limit(2).Pluck("id", &ids).Error; err != nil {
+			return 0, err
+		}
+	}
+	if len(ids) != 1 {
+		log.Printf("daily book [%d]: %d authors match %q, skipping the person", bookID, len(ids), fullName)
+		return 0, nil
+	}
+	return ids[0], nil
+}
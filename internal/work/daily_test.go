@@ -0,0 +1,147 @@
+package work_test
+
+import (
+	"context"
+	"github.com/matperez/flibusta-parser/internal/fb2"
+	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
+	"github.com/matperez/flibusta-parser/internal/flibustatest"
+	storage2 "github.com/matperez/flibusta-parser/internal/storage"
+	"github.com/matperez/flibusta-parser/internal/work"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStoreDailyBook(t *testing.T) {
+	db := openTestDB(t)
+	code := "sf_social"
+	known := []interface{}{
+		&storage2.Author{ID: 10, Name: "Аркадий Натанович Стругацкий", FirstName: "Аркадий", MiddleName: "Натанович", LastName: "Стругацкий"},
+		// однофамильцы с одним именем без отчества неразличимы
+		&storage2.Author{ID: 20, Name: "Иван Иванов", FirstName: "Иван", LastName: "Иванов"},
+		&storage2.Author{ID: 21, Name: "Иван Иванов", FirstName: "Иван", LastName: "Иванов"},
+		&storage2.Author{ID: 22, Name: "Иван Петрович Иванов", FirstName: "Иван", MiddleName: "Петрович", LastName: "Иванов"},
+		// автор со страницы книги известен только по полному имени
+		&storage2.Author{ID: 30, Name: "Кир Булычев"},
+		&storage2.Genre{ID: 5, Title: "Социальная фантастика", Code: &code},
+		&storage2.Series{ID: 7, Title: "НИИЧАВО"},
+	}
+	for _, model := range known {
+		if err := db.Create(model).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	info := &fb2.TitleInfo{
+		BookTitle: "Понедельник начинается в субботу",
+		Genres:    []string{"sf_social", "unknown"},
+		Authors: []fb2.Person{
+			{FirstName: "Аркадий", MiddleName: "Натанович", LastName: "Стругацкий"},
+			{FirstName: "Иван", LastName: "Иванов"},
+			{FirstName: "Иван", MiddleName: "Петрович", LastName: "Иванов"},
+			{FirstName: "Кир", LastName: "Булычев"},
+			{FirstName: "Неизвестный", LastName: "Автор"},
+		},
+		Lang:      "ru",
+		Sequences: []fb2.Sequence{{Name: "НИИЧАВО", Number: "1"}, {Name: "Нет такого сериала", Number: "2"}},
+	}
+	// повторный импорт того же файла не дублирует связи
+	for i := 0; i < 2; i++ {
+		if err := work.StoreDailyBook(db, 5005, 402000, info); err != nil {
+			t.Fatalf("StoreDailyBook() error = %v", err)
+		}
+	}
+
+	var book storage2.Book
+	if err := db.Preload("Contributors").Preload("Genres").Preload("Series").First(&book, 5005).Error; err != nil {
+		t.Fatal(err)
+	}
+	var authors, genres, series []uint
+	for _, c := range book.Contributors {
+		authors = append(authors, c.AuthorID)
+	}
+	for _, g := range book.Genres {
+		genres = append(genres, g.ID)
+	}
+	for _, s := range book.Series {
+		series = append(series, s.SeriesID, s.Number)
+	}
+	if want := []uint{10, 22, 30}; !reflect.DeepEqual(authors, want) {
+		t.Errorf("StoreDailyBook() got authors = %v, want %v", authors, want)
+	}
+	if want := []uint{5}; !reflect.DeepEqual(genres, want) {
+		t.Errorf("StoreDailyBook() got genres = %v, want %v", genres, want)
+	}
+	if want := []uint{7, 1}; !reflect.DeepEqual(series, want) {
+		t.Errorf("StoreDailyBook() got series = %v, want %v", series, want)
+	}
+	if book.Title != info.BookTitle || book.Lang != "ru" || book.Size != 402000 {
+		t.Errorf("StoreDailyBook() got book = %v %v %v", book.Title, book.Lang, book.Size)
+	}
+
+	// у книги со страницы размер файла и год издания, а не несжатый FB2 и дата написания
+	if err := db.Create(&storage2.Book{ID: 9, Title: "Пикник на обочине", Size: 180000, Year: 2021}).Error; err != nil {
+		t.Fatal(err)
+	}
+	picnic, err := fb2.ReadTitleInfo(strings.NewReader(`<?xml version="1.0" encoding="utf-8"?>
+<FictionBook><description><title-info><book-title>Пикник на обочине</book-title><date>1972</date></title-info></description></FictionBook>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = work.StoreDailyBook(db, 9, 402000, picnic); err != nil {
+		t.Fatalf("StoreDailyBook() error = %v", err)
+	}
+	var parsed storage2.Book
+	if err := db.First(&parsed, 9).Error; err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Size != 180000 || parsed.Year != 2021 {
+		t.Errorf("StoreDailyBook() got parsed book size and year = %v %v, want %v %v", parsed.Size, parsed.Year, 180000, 2021)
+	}
+}
+
+func TestFetchDailyArchives(t *testing.T) {
+	server := flibustatest.NewServer("../flibusta/test-pages", "reader", "secret")
+	defer server.Close()
+	server.Serve("/daily/f.fb2.811901-812034.zip", []byte("first archive"))
+	server.Serve("/daily/f.fb2.812035-812190.zip", []byte("second archive"))
+	flb := newTestClient(t, server)
+	dir, err := ioutil.TempDir("", "flibusta-daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// уже скачанный архив не запрашивается снова
+	if err = ioutil.WriteFile(filepath.Join(dir, "f.fb2.811901-812034.zip"), []byte("stored archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// сессия истекла, клиент должен войти заново, а не сохранить страницу входа
+	server.ExpireSessions()
+	if err = work.FetchDailyArchives(context.Background(), flb, dir); err != nil {
+		t.Fatalf("FetchDailyArchives() error = %v", err)
+	}
+	if got := server.Logins(); got != 2 {
+		t.Errorf("logins got = %v, want %v", got, 2)
+	}
+	for name, want := range map[string]string{"f.fb2.811901-812034.zip": "stored archive", "f.fb2.812035-812190.zip": "second archive"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Errorf("archive %s got = %q, want %q", name, content, want)
+		}
+	}
+
+	server.Inject("/daily/f.fb2.812035-812190.zip", flibustatest.Fault{Status: http.StatusForbidden})
+	if err = os.Remove(filepath.Join(dir, "f.fb2.812035-812190.zip")); err != nil {
+		t.Fatal(err)
+	}
+	err = work.FetchDailyArchives(context.Background(), flb, dir)
+	if class := flibusta2.ClassOf(err); class != flibusta2.ErrBlocked {
+		t.Errorf("FetchDailyArchives() got error class = %v, want %v", class, flibusta2.ErrBlocked)
+	}
+}
@@ -0,0 +1,114 @@
+package work
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
+	storage2 "github.com/matperez/flibusta-parser/internal/storage"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//DefaultBookLayout places the books into author and series directories
+const DefaultBookLayout = "{author}/{series}/{title} [{id}].{format}"
+
+//sanitizePathPart makes a single path component safe for any file system
+func sanitizePathPart(part string) string {
+	part = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, part)
+	if runes := []rune(part); len(runes) > 100 {
+		part = string(runes[:100])
+	}
+	return strings.Trim(part, " .")
+}
+
+//BookPath fills the layout placeholders {id}, {title}, {author}, {series}, {number} and {format}.
+//The book must be loaded with its contributors and series, empty directories are dropped.
+func BookPath(layout string, book *storage2.Book, format string) string {
+	var author, series, number string
+	for _, c := range book.Contributors {
+		if c.Role == string(flibusta2.RoleAuthor) && c.Author != nil {
+			author = c.Author.Name
+			break
+		}
+	}
+	if len(book.Series) > 0 && book.Series[0].Series != nil {
+		series = book.Series[0].Series.Title
+		if book.Series[0].Number > 0 {
+			number = strconv.Itoa(int(book.Series[0].Number))
+		}
+	}
+	var parts []string
+	for _, part := range strings.Split(layout, "/") {
+		part = strings.NewReplacer(
+			"{id}", strconv.Itoa(int(book.ID)),
+			"{title}", book.Title,
+			"{author}", author,
+			"{series}", series,
+			"{number}", number,
+			"{format}", format,
+		).Replace(part)
+		if part = sanitizePathPart(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return filepath.Join(parts...)
+}
+
+//DownloadBook saves the book file into the directory by the layout and records its checksum
+func DownloadBook(ctx context.Context, db *gorm.DB, flb flibusta2.Client, dir, layout, format string, book *storage2.Book) (*storage2.BookFile, error) {
+	file, err := flb.DownloadBook(ctx, int(book.ID), format)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Body.Close()
+	ext := format
+	if ext == "" {
+		ext = strings.TrimPrefix(filepath.Ext(file.Name), ".")
+	}
+	path := filepath.Join(dir, BookPath(layout, book, ext))
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrap(err, "error creating the book directory")
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating a temporary book file")
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), file.Body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error writing the book file")
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return nil, errors.Wrap(err, "error moving the book file")
+	}
+	record := &storage2.BookFile{
+		BookID: book.ID,
+		Format: ext,
+		Path:   path,
+		Size:   uint64(size),
+		Sha256: hex.EncodeToString(hash.Sum(nil)),
+	}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "book_id"}, {Name: "format"}},
+		DoUpdates: clause.AssignmentColumns([]string{"path", "size", "sha256", "updated_at"}),
+	}).Create(record).Error
+	return record, err
+}
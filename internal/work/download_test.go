@@ -0,0 +1,130 @@
+package work_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
+	storage2 "github.com/matperez/flibusta-parser/internal/storage"
+	"github.com/matperez/flibusta-parser/internal/work"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testDownloadBook() *storage2.Book {
+	return &storage2.Book{
+		ID:    5005,
+		Title: "Понедельник: начинается в субботу?",
+		Contributors: []*storage2.BookAuthor{
+			{AuthorID: 2, Role: string(flibusta2.RoleTranslator), Author: &storage2.Author{ID: 2, Name: "Переводчик"}},
+			{AuthorID: 1, Role: string(flibusta2.RoleAuthor), Author: &storage2.Author{ID: 1, Name: "А. Стругацкий / Б. Стругацкий"}},
+		},
+		Series: []*storage2.BookSeries{{SeriesID: 7, Number: 1, Series: &storage2.Series{ID: 7, Title: "НИИЧАВО"}}},
+	}
+}
+
+func TestBookPath(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		layout string
+		book   *storage2.Book
+		format string
+		want   string
+	}{
+		{
+			name:   "Default layout",
+			layout: work.DefaultBookLayout,
+			book:   testDownloadBook(),
+			format: "fb2",
+			want:   filepath.Join("А. Стругацкий _ Б. Стругацкий", "НИИЧАВО", "Понедельник_ начинается в субботу_ [5005].fb2"),
+		},
+		{
+			name:   "Series number",
+			layout: "{series}/{number}. {title}.{format}",
+			book:   testDownloadBook(),
+			format: "epub",
+			want:   filepath.Join("НИИЧАВО", "1. Понедельник_ начинается в субботу_.epub"),
+		},
+		{
+			// пустые директории пропускаются, а попытки выйти из директории обезвреживаются
+			name:   "No author and series",
+			layout: work.DefaultBookLayout,
+			book:   &storage2.Book{ID: 9, Title: "../.."},
+			format: "fb2",
+			want:   "_.. [9].fb2",
+		},
+		{
+			name:   "Long title",
+			layout: "{title}",
+			book:   &storage2.Book{ID: 9, Title: strings.Repeat("я", 150)},
+			want:   strings.Repeat("я", 100),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := work.BookPath(tt.layout, tt.book, tt.format); got != tt.want {
+				t.Errorf("BookPath() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//downloadClient returns the same content for every book
+type downloadClient struct {
+	flibusta2.Client
+	name    string
+	content string
+}
+
+func (c *downloadClient) DownloadBook(ctx context.Context, id int, format string) (*flibusta2.BookFile, error) {
+	return &flibusta2.BookFile{Name: c.name, Body: ioutil.NopCloser(strings.NewReader(c.content))}, nil
+}
+
+func TestDownloadBook(t *testing.T) {
+	db := openTestDB(t)
+	dir, err := ioutil.TempDir("", "flibusta-books")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	book := testDownloadBook()
+	if err = db.Create(&storage2.Book{ID: book.ID, Title: book.Title}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// повторное скачивание обновляет запись о файле
+	for _, content := range []string{"первая версия", "вторая версия"} {
+		flb := &downloadClient{name: "5005.pdf", content: content}
+		file, err := work.DownloadBook(context.Background(), db, flb, dir, "{id}.{format}", "", book)
+		if err != nil {
+			t.Fatalf("DownloadBook() error = %v", err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		if want := hex.EncodeToString(sum[:]); file.Sha256 != want {
+			t.Errorf("DownloadBook() got sha256 = %v, want %v", file.Sha256, want)
+		}
+		if want := filepath.Join(dir, "5005.pdf"); file.Path != want {
+			t.Errorf("DownloadBook() got path = %v, want %v", file.Path, want)
+		}
+		stored, err := ioutil.ReadFile(file.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(stored) != content {
+			t.Errorf("stored file got = %q, want %q", stored, content)
+		}
+	}
+	var records []storage2.BookFile
+	if err = db.Find(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("вторая версия"))
+	if len(records) != 1 || records[0].Format != "pdf" || records[0].Sha256 != hex.EncodeToString(sum[:]) || records[0].Size != uint64(len("вторая версия")) {
+		t.Errorf("book files got = %+v, want one pdf record of the second version", records)
+	}
+}
@@ -0,0 +1,340 @@
+package work
+
+import (
+	"github.com/matperez/flibusta-parser/internal/flibusta"
+	"github.com/matperez/flibusta-parser/internal/sqldump"
+	storage2 "github.com/matperez/flibusta-parser/internal/storage"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//dumpImport loads the Flibusta SQL dump tables into the storage
+type dumpImport struct {
+	db        *gorm.DB
+	dir       string
+	batchSize int
+	books     map[uint]bool
+	authors   map[uint]bool
+	genres    map[uint]bool
+	series    map[uint]bool
+}
+
+//ImportDump loads the Flibusta SQL dump files (lib.libbook.sql.gz and others) from the directory.
+//Only libbook is required, the other tables are imported when they are present.
+func ImportDump(db *gorm.DB, dir string, batchSize int) error {
+	im := &dumpImport{
+		db:        db,
+		dir:       dir,
+		batchSize: batchSize,
+		books:     map[uint]bool{},
+		authors:   map[uint]bool{},
+		genres:    map[uint]bool{},
+		series:    map[uint]bool{},
+	}
+	// связи ссылаются на книги, авторов, жанры и сериалы, поэтому они загружаются в конце
+	steps := []func() error{
+		im.importAuthors,
+		im.importGenres,
+		im.importSeries,
+		im.importBooks,
+		im.importAnnotations,
+		im.importBookAuthors("libavtor", "AvtorId", flibusta.RoleAuthor),
+		im.importBookAuthors("libtranslator", "TranslatorId", flibusta.RoleTranslator),
+		im.importBookGenres,
+		im.importBookSeries,
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//findDumpFile returns the path of the table dump or an empty string if there is none
+func findDumpFile(dir, table string) string {
+	for _, name := range []string{"lib." + table + ".sql.gz", table + ".sql.gz", "lib." + table + ".sql", table + ".sql"} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+//each calls fn for every row of the table dump
+func (im *dumpImport) each(table string, required bool, fn func(sqldump.Row) error) error {
+	path := findDumpFile(im.dir, table)
+	if path == "" {
+		if required {
+			return errors.Errorf("error importing the dump: the %s table file is not found in %s", table, im.dir)
+		}
+		log.Printf("the %s table file is not found, skipping", table)
+		return nil
+	}
+	log.Printf("importing %s", path)
+	file, err := sqldump.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return sqldump.NewReader(file).Each(table, fn)
+}
+
+//batch collects rows and writes them with the flush function once there are enough of them
+type batch struct {
+	size  int
+	count int
+	rows  []interface{}
+	flush func(rows interface{}) error
+}
+
+func (b *batch) add(row interface{}) error {
+	b.rows = append(b.rows, row)
+	if len(b.rows) < b.size {
+		return nil
+	}
+	return b.done()
+}
+
+//done writes the rows left
+func (b *batch) done() error {
+	if len(b.rows) == 0 {
+		return nil
+	}
+	// gorm вставляет срез одним запросом только если у него конкретный тип элементов
+	rows := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(b.rows[0])), 0, len(b.rows))
+	for _, row := range b.rows {
+		rows = reflect.Append(rows, reflect.ValueOf(row))
+	}
+	if err := b.flush(rows.Interface()); err != nil {
+		return err
+	}
+	b.count += len(b.rows)
+	b.rows = b.rows[:0]
+	return nil
+}
+
+//upsert returns a flush function saving the rows with the given columns updated on conflict,
+//without columns the conflicting rows are skipped
+func (im *dumpImport) upsert(columns ...string) func(rows interface{}) error {
+	onConflict := clause.OnConflict{DoNothing: true}
+	if len(columns) > 0 {
+		onConflict = clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns(append(columns, "updated_at")),
+		}
+	}
+	return func(rows interface{}) error {
+		return im.db.Clauses(onConflict).Create(rows).Error
+	}
+}
+
+func joinName(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+func (im *dumpImport) importAuthors() error {
+	b := &batch{size: im.batchSize, flush: im.upsert("name", "first_name", "middle_name", "last_name")}
+	err := im.each("libavtorname", false, func(row sqldump.Row) error {
+		author := &storage2.Author{
+			ID:         uint(row.Int("AvtorId")),
+			FirstName:  row["FirstName"],
+			MiddleName: row["MiddleName"],
+			LastName:   row["LastName"],
+		}
+		author.Name = joinName(author.FirstName, author.MiddleName, author.LastName)
+		if author.Name == "" {
+			author.Name = row["NickName"]
+		}
+		im.authors[author.ID] = true
+		return b.add(author)
+	})
+	if err == nil {
+		err = b.done()
+	}
+	log.Printf("imported %d authors", b.count)
+	return err
+}
+
+func (im *dumpImport) importGenres() error {
+	b := &batch{size: im.batchSize, flush: im.upsert("title", "code", "group_code")}
+	err := im.each("libgenrelist", false, func(row sqldump.Row) error {
+		genre := &storage2.Genre{
+			ID:    uint(row.Int("GenreId")),
+			Title: row["GenreDesc"],
+		}
+		if code := row["GenreCode"]; code != "" {
+			genre.Code = &code
+			if group := flibusta.GenreGroupOf(code); group != "" {
+				genre.GroupCode = &group
+			}
+		}
+		im.genres[genre.ID] = true
+		return b.add(genre)
+	})
+	if err == nil {
+		err = b.done()
+	}
+	log.Printf("imported %d genres", b.count)
+	return err
+}
+
+func (im *dumpImport) importSeries() error {
+	b := &batch{size: im.batchSize, flush: im.upsert("title")}
+	err := im.each("libseqname", false, func(row sqldump.Row) error {
+		series := &storage2.Series{
+			ID:    uint(row.Int("SeqId")),
+			Title: row["SeqName"],
+		}
+		im.series[series.ID] = true
+		return b.add(series)
+	})
+	if err == nil {
+		err = b.done()
+	}
+	log.Printf("imported %d series", b.count)
+	return err
+}
+
+func (im *dumpImport) importBooks() error {
+	// статус обновляется только у удаленных книг, иначе импорт сбросил бы статусы blocked и replaced,
+	// полученные при парсинге страниц
+	columns := []string{"title", "format", "size", "pages", "year", "added_at"}
+	b := &batch{size: im.batchSize, flush: im.upsert(columns...)}
+	deleted := &batch{size: im.batchSize, flush: im.upsert(append(columns, "status")...)}
+	err := im.each("libbook", true, func(row sqldump.Row) error {
+		book := &storage2.Book{
+			ID:     uint(row.Int("BookId")),
+			Title:  row["Title"],
+			Format: row["FileType"],
+			Size:   uint64(row.Int("FileSize")),
+			Pages:  uint(row.Int("Pages")),
+			Year:   uint(row.Int("Year")),
+			Status: string(flibusta.StatusActive),
+		}
+		if added, err := time.ParseInLocation("2006-01-02 15:04:05", row["Time"], time.Local); err == nil {
+			book.AddedAt = &added
+		}
+		im.books[book.ID] = true
+		if row["Deleted"] != "" && row["Deleted"] != "0" {
+			book.Status = string(flibusta.StatusDeleted)
+			return deleted.add(book)
+		}
+		return b.add(book)
+	})
+	if err == nil {
+		err = b.done()
+	}
+	if err == nil {
+		err = deleted.done()
+	}
+	log.Printf("imported %d books, %d of them deleted", b.count+deleted.count, deleted.count)
+	return err
+}
+
+//dumpAnnotation is the annotation of an imported book
+type dumpAnnotation struct {
+	BookID uint
+	Body   string
+}
+
+func (im *dumpImport) importAnnotations() error {
+	// у книг только обновляется одно поле, поэтому пачка пишется одной транзакцией, а не вставкой
+	b := &batch{size: im.batchSize, flush: func(rows interface{}) error {
+		return im.db.Transaction(func(tx *gorm.DB) error {
+			for _, a := range rows.([]*dumpAnnotation) {
+				if err := tx.Model(&storage2.Book{ID: a.BookID}).Update("annotation", a.Body).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}}
+	err := im.each("libbannotations", false, func(row sqldump.Row) error {
+		id := uint(row.Int("BookId"))
+		body := strings.TrimSpace(row["Body"])
+		if !im.books[id] || body == "" {
+			return nil
+		}
+		return b.add(&dumpAnnotation{BookID: id, Body: body})
+	})
+	if err == nil {
+		err = b.done()
+	}
+	log.Printf("imported %d annotations", b.count)
+	return err
+}
+
+func (im *dumpImport) importBookAuthors(table, column string, role flibusta.Role) func() error {
+	return func() error {
+		b := &batch{size: im.batchSize, flush: im.upsert()}
+		err := im.each(table, false, func(row sqldump.Row) error {
+			link := &storage2.BookAuthor{
+				BookID:   uint(row.Int("BookId")),
+				AuthorID: uint(row.Int(column)),
+				Role:     string(role),
+			}
+			if !im.books[link.BookID] || !im.authors[link.AuthorID] {
+				return nil
+			}
+			return b.add(link)
+		})
+		if err == nil {
+			err = b.done()
+		}
+		log.Printf("imported %d %s links", b.count, role)
+		return err
+	}
+}
+
+func (im *dumpImport) importBookGenres() error {
+	b := &batch{size: im.batchSize, flush: func(rows interface{}) error {
+		return im.db.Table("book_genres").Clauses(clause.OnConflict{DoNothing: true}).Create(rows).Error
+	}}
+	err := im.each("libgenre", false, func(row sqldump.Row) error {
+		bookID, genreID := uint(row.Int("BookId")), uint(row.Int("GenreId"))
+		if !im.books[bookID] || !im.genres[genreID] {
+			return nil
+		}
+		return b.add(map[string]interface{}{"book_id": bookID, "genre_id": genreID})
+	})
+	if err == nil {
+		err = b.done()
+	}
+	log.Printf("imported %d genre links", b.count)
+	return err
+}
+
+func (im *dumpImport) importBookSeries() error {
+	b := &batch{size: im.batchSize, flush: im.upsert()}
+	err := im.each("libseq", false, func(row sqldump.Row) error {
+		link := &storage2.BookSeries{
+			BookID:   uint(row.Int("BookId")),
+			SeriesID: uint(row.Int("SeqId")),
+			Number:   uint(row.Int("SeqNumb")),
+		}
+		if !im.books[link.BookID] || !im.series[link.SeriesID] {
+			return nil
+		}
+		return b.add(link)
+	})
+	if err == nil {
+		err = b.done()
+	}
+	log.Printf("imported %d series links", b.count)
+	return err
+}
@@ -0,0 +1,116 @@
+package work_test
+
+import (
+	"compress/gzip"
+	storage2 "github.com/matperez/flibusta-parser/internal/storage"
+	"github.com/matperez/flibusta-parser/internal/work"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+//testDumpTables are the dump files in the format of https://flibusta.is/sql
+var testDumpTables = map[string]string{
+	"libbook": "INSERT INTO `libbook` (`BookId`,`FileSize`,`Time`,`Title`,`FileType`,`Deleted`,`Year`,`Pages`) VALUES " +
+		"(1,402000,'2009-01-21 10:00:00','Понедельник начинается в субботу','fb2','0',1965,250)," +
+		"(2,69000,'2009-01-22 10:00:00','Внетелесный опыт','fb2','1',0,0)," +
+		"(3,12000,'2009-01-23 10:00:00','Заблокированная книга','fb2','0',2001,10);\n",
+	"libavtorname": "INSERT INTO `libavtorname` (`AvtorId`,`FirstName`,`MiddleName`,`LastName`,`NickName`) VALUES " +
+		"(10,'Аркадий','Натанович','Стругацкий',''),(11,'Борис','Натанович','Стругацкий',''),(12,'','','','Аноним');\n",
+	"libavtor":        "INSERT INTO `libavtor` (`BookId`,`AvtorId`) VALUES (1,10),(1,11),(2,12),(1,99);\n",
+	"libgenrelist":    "INSERT INTO `libgenrelist` (`GenreId`,`GenreCode`,`GenreDesc`) VALUES (5,'sf_social','Социальная фантастика');\n",
+	"libgenre":        "INSERT INTO `libgenre` (`BookId`,`GenreId`) VALUES (1,5),(4,5);\n",
+	"libseqname":      "INSERT INTO `libseqname` (`SeqId`,`SeqName`) VALUES (7,'НИИЧАВО');\n",
+	"libseq":          "INSERT INTO `libseq` (`BookId`,`SeqId`,`SeqNumb`) VALUES (1,7,1);\n",
+	"libbannotations": "INSERT INTO `libbannotations` (`BookId`,`Title`,`Body`) VALUES (1,'','Сказка для научных сотрудников'),(2,'','');\n",
+}
+
+func writeTestDump(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "flibusta-dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for table, content := range testDumpTables {
+		file, err := os.Create(filepath.Join(dir, "lib."+table+".sql.gz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := gzip.NewWriter(file)
+		if _, err = w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = file.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestImportDump(t *testing.T) {
+	db := openTestDB(t)
+	// статус, полученный при парсинге страницы, не должен сбрасываться импортом
+	if err := db.Create(&storage2.Book{ID: 3, Title: "Заблокированная книга", Status: "blocked"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	dir := writeTestDump(t)
+	// повторный импорт не должен дублировать связи
+	for i := 0; i < 2; i++ {
+		if err := work.ImportDump(db, dir, 2); err != nil {
+			t.Fatalf("ImportDump() error = %v", err)
+		}
+	}
+
+	var books []*storage2.Book
+	if err := db.Preload("Contributors").Preload("Genres").Preload("Series").Order("id").Find(&books).Error; err != nil {
+		t.Fatal(err)
+	}
+	type stored struct {
+		ID         uint
+		Title      string
+		Status     string
+		Year       uint
+		Annotation string
+		Authors    []uint
+		Genres     []uint
+		Series     []uint
+	}
+	var got []stored
+	for _, b := range books {
+		s := stored{ID: b.ID, Title: b.Title, Status: b.Status, Year: b.Year}
+		if b.Annotation != nil {
+			s.Annotation = *b.Annotation
+		}
+		for _, c := range b.Contributors {
+			s.Authors = append(s.Authors, c.AuthorID)
+		}
+		for _, g := range b.Genres {
+			s.Genres = append(s.Genres, g.ID)
+		}
+		for _, bs := range b.Series {
+			s.Series = append(s.Series, bs.SeriesID, bs.Number)
+		}
+		got = append(got, s)
+	}
+	want := []stored{
+		{ID: 1, Title: "Понедельник начинается в субботу", Status: "active", Year: 1965, Annotation: "Сказка для научных сотрудников", Authors: []uint{10, 11}, Genres: []uint{5}, Series: []uint{7, 1}},
+		{ID: 2, Title: "Внетелесный опыт", Status: "deleted", Authors: []uint{12}},
+		{ID: 3, Title: "Заблокированная книга", Status: "blocked", Year: 2001},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stored books got = %+v, want %+v", got, want)
+	}
+
+	var author storage2.Author
+	if err := db.First(&author, 12).Error; err != nil {
+		t.Fatal(err)
+	}
+	if author.Name != "Аноним" {
+		t.Errorf("author name got = %v, want %v", author.Name, "Аноним")
+	}
+}
@@ -0,0 +1,22 @@
+package work
+
+import (
+	"context"
+	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
+	"github.com/matperez/flibusta-parser/internal/pool"
+	"gorm.io/gorm"
+)
+
+//NewHandler returns the pool handler doing the book, author and series jobs
+func NewHandler(db *gorm.DB, flb flibusta2.Client, opts Options) pool.Handler {
+	return func(ctx context.Context, job pool.Work) error {
+		workerId := pool.WorkerID(ctx)
+		if job.AuthorID != 0 {
+			return DoAuthorWork(ctx, db, flb, job.AuthorID, workerId)
+		}
+		if job.SeriesID != 0 {
+			return DoSeriesWork(ctx, db, flb, job.SeriesID, workerId)
+		}
+		return DoWork(ctx, db, flb, opts, job.BookID, workerId)
+	}
+}
@@ -0,0 +1,373 @@
+package work_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/matperez/flibusta-parser/internal/covers"
+	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
+	"github.com/matperez/flibusta-parser/internal/flibustatest"
+	"github.com/matperez/flibusta-parser/internal/pool"
+	storage2 "github.com/matperez/flibusta-parser/internal/storage"
+	"github.com/matperez/flibusta-parser/internal/work"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	dir, err := ioutil.TempDir("", "flibusta-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	dsn := filepath.Join(dir, "flibusta.db") + "?_busy_timeout=5000&_txlock=immediate"
+	db, err := storage2.Open(storage2.DriverSQLite, dsn, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = storage2.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestClient(t *testing.T, server *flibustatest.Server) flibusta2.Client {
+	flb, err := flibusta2.NewFlibusta(flibusta2.Options{
+		BaseURL:   server.URL,
+		RateLimit: flibusta2.RateLimit{MaxRetries: 2, Backoff: time.Millisecond},
+		Timeout:   time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = flb.Auth(server.Username, server.Password); err != nil {
+		t.Fatalf("Auth() error = %v", err)
+	}
+	return flb
+}
+
+func TestParsePipeline(t *testing.T) {
+	server := flibustatest.NewServer("../flibusta/test-pages", "reader", "secret")
+	defer server.Close()
+	// первые два запроса к книге отклоняются из-за нагрузки, клиент должен их повторить
+	server.Inject("/b/235391", flibustatest.Fault{Status: http.StatusTooManyRequests, RetryAfter: "0", Times: 2})
+	server.Inject("/b/611196", flibustatest.Fault{Delay: 50 * time.Millisecond})
+	// книга заблокирована для всех запросов
+	server.Inject("/b/12", flibustatest.Fault{Status: http.StatusForbidden})
+	db := openTestDB(t)
+	flb := newTestClient(t, server)
+
+	opts := work.Options{Retry: work.RetryPolicy{Attempts: 2, Backoff: time.Millisecond}}
+	workers := pool.New(context.Background(), 3, 10, work.NewHandler(db, flb, opts))
+	for i, id := range []int{9, 10, 12, 235391, 611196} {
+		workers.Submit(context.Background(), pool.Work{ID: i, BookID: id})
+	}
+	workers.Close()
+	summary := workers.Wait()
+	if want := (pool.Summary{Processed: 5, Failed: 2}); summary != want {
+		t.Errorf("Wait() got = %+v, want %+v", summary, want)
+	}
+
+	var stored []uint
+	if err := db.Model(&storage2.Book{}).Order("id").Pluck("id", &stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint{9, 235391, 611196}; !reflect.DeepEqual(stored, want) {
+		t.Errorf("stored books got = %v, want %v", stored, want)
+	}
+	var attempts []storage2.CrawlAttempt
+	if err := db.Order("book_id").Find(&attempts).Error; err != nil {
+		t.Fatal(err)
+	}
+	type attempt struct {
+		BookID     uint
+		Status     string
+		ErrorClass string
+		HTTPStatus int
+	}
+	var got []attempt
+	for _, a := range attempts {
+		got = append(got, attempt{BookID: a.BookID, Status: a.Status, ErrorClass: a.ErrorClass, HTTPStatus: a.HTTPStatus})
+	}
+	want := []attempt{
+		{BookID: 9, Status: string(work.CrawlDone)},
+		{BookID: 10, Status: string(work.CrawlMissing), ErrorClass: string(flibusta2.ErrNotFound), HTTPStatus: http.StatusNotFound},
+		{BookID: 12, Status: string(work.CrawlMissing), ErrorClass: string(flibusta2.ErrBlocked), HTTPStatus: http.StatusForbidden},
+		{BookID: 235391, Status: string(work.CrawlDone)},
+		{BookID: 611196, Status: string(work.CrawlDone)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("crawl attempts got = %+v, want %+v", got, want)
+	}
+	if got := server.Requests("/b/235391"); got != 3 {
+		t.Errorf("requests of the rate limited book got = %v, want %v", got, 3)
+	}
+
+	pending, err := work.PendingJobs(db, 9, 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{11}; !reflect.DeepEqual(pending, want) {
+		t.Errorf("PendingJobs() got = %v, want %v", pending, want)
+	}
+}
+
+func TestSyncJobs(t *testing.T) {
+	server := flibustatest.NewServer("../flibusta/test-pages", "reader", "secret")
+	defer server.Close()
+	db := openTestDB(t)
+	flb := newTestClient(t, server)
+	// на странице новинок последняя книга 812345
+	if err := db.Create(&storage2.Book{ID: 812340, Title: "Последняя сохраненная"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		queued int
+		want   []int
+	}{
+		{name: "Nothing queued", queued: 0, want: []int{812341, 812342, 812343, 812344, 812345}},
+		{name: "Queued before the last stored", queued: 812300, want: []int{812341, 812342, 812343, 812344, 812345}},
+		{name: "Queued after the last stored", queued: 812343, want: []int{812344, 812345}},
+		{name: "Everything queued", queued: 812345, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := work.SyncJobs(context.Background(), db, flb, tt.queued)
+			if err != nil {
+				t.Fatalf("SyncJobs() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SyncJobs() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// новых книг на сайте нет, поэтому все задачи синхронизации заканчиваются отсутствующими страницами
+	jobs, err := work.SyncJobs(context.Background(), db, flb, 0)
+	if err != nil {
+		t.Fatalf("SyncJobs() error = %v", err)
+	}
+	workers := pool.New(context.Background(), 2, 10, work.NewHandler(db, flb, work.Options{}))
+	for i, id := range jobs {
+		workers.Submit(context.Background(), pool.Work{ID: i, BookID: id})
+	}
+	workers.Close()
+	workers.Wait()
+	pending, err := work.PendingJobs(db, 812341, 812346)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("PendingJobs() got = %v, want %v", pending, []int{})
+	}
+	if got := server.Requests("/new"); got != len(tests)+1 {
+		t.Errorf("requests of the new arrivals page got = %v, want %v", got, len(tests)+1)
+	}
+
+	server.Inject("/new", flibustatest.Fault{Status: http.StatusServiceUnavailable})
+	if _, err = work.SyncJobs(context.Background(), db, flb, 0); err == nil {
+		t.Errorf("SyncJobs() error = nil, want an error")
+	}
+}
+
+func TestParsePipeline_cancelled(t *testing.T) {
+	server := flibustatest.NewServer("../flibusta/test-pages", "reader", "secret")
+	defer server.Close()
+	// сайт просит подождать час, отмененный воркер не должен ждать ни паузу сайта, ни паузу между попытками
+	server.Inject("/b/9", flibustatest.Fault{Status: http.StatusServiceUnavailable, RetryAfter: "3600"})
+	db := openTestDB(t)
+	flb := newTestClient(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	opts := work.Options{Retry: work.RetryPolicy{Attempts: 3, Backoff: time.Hour}}
+	if err := work.DoWork(ctx, db, flb, opts, 9, 1); err == nil {
+		t.Errorf("DoWork() error = nil, want an error")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("DoWork() waited %v after the context was cancelled", elapsed)
+	}
+	if got := server.Requests("/b/9"); got != 1 {
+		t.Errorf("requests of the book got = %v, want %v", got, 1)
+	}
+	pending, err := work.PendingJobs(db, 9, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{9}; !reflect.DeepEqual(pending, want) {
+		t.Errorf("PendingJobs() got = %v, want %v", pending, want)
+	}
+}
+
+func TestParsePipeline_expiredSession(t *testing.T) {
+	server := flibustatest.NewServer("../flibusta/test-pages", "reader", "secret")
+	defer server.Close()
+	db := openTestDB(t)
+	flb := newTestClient(t, server)
+	server.ExpireSessions()
+
+	if err := work.DoWork(context.Background(), db, flb, work.Options{}, 9, 1); err != nil {
+		t.Errorf("DoWork() error = %v", err)
+	}
+	if got := server.Logins(); got != 2 {
+		t.Errorf("logins got = %v, want %v", got, 2)
+	}
+	var book storage2.Book
+	if err := db.First(&book, 9).Error; err != nil {
+		t.Errorf("the book is not stored: %v", err)
+	}
+}
+
+func TestAuth_wrongPassword(t *testing.T) {
+	server := flibustatest.NewServer("../flibusta/test-pages", "reader", "secret")
+	defer server.Close()
+	flb, err := flibusta2.NewFlibusta(flibusta2.Options{BaseURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = flb.Auth("reader", "wrong"); err == nil {
+		t.Errorf("Auth() error = nil, want an error")
+	}
+}
+
+func TestStoreReviews(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.Create(&storage2.Book{ID: 5005, Title: "Понедельник начинается в субботу"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	reviews := []flibusta2.Review{
+		{UserID: 893067, User: "Kalina_krasnaya", Date: time.Date(2021, 2, 14, 0, 0, 0, 0, time.UTC), Rating: 5, Text: "Перечитываю каждый год."},
+		{UserID: 117215, User: "reader", Text: "Без оценки."},
+		{UserID: 42, User: "gone", Rating: 1, Text: "Удалено."},
+	}
+	if err := work.StoreReviews(db, 5005, work.MapReviewsToStore(5005, reviews)); err != nil {
+		t.Fatalf("StoreReviews() error = %v", err)
+	}
+	var created storage2.Review
+	if err := db.Where("user_id = ?", 117215).First(&created).Error; err != nil {
+		t.Fatal(err)
+	}
+	// повторный парсинг обновляет отзывы, а не дублирует их, и удаляет пропавшие со страницы
+	reviews[1].Rating = 4
+	if err := work.StoreReviews(db, 5005, work.MapReviewsToStore(5005, reviews[:2])); err != nil {
+		t.Fatalf("StoreReviews() error = %v", err)
+	}
+	var stored []storage2.Review
+	if err := db.Order("user_id").Find(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	var got []uint
+	for _, r := range stored {
+		got = append(got, r.UserID, r.Rating)
+	}
+	if want := []uint{117215, 4, 893067, 5}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("stored reviews got = %v, want %v", got, want)
+	}
+	if stored[0].ID != created.ID || !stored[0].CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("updated review got = %v %v, want %v %v", stored[0].ID, stored[0].CreatedAt, created.ID, created.CreatedAt)
+	}
+	if stored[1].ReviewedAt == nil || stored[0].ReviewedAt != nil {
+		t.Errorf("stored review dates got = %v, %v", stored[0].ReviewedAt, stored[1].ReviewedAt)
+	}
+}
+
+func TestStoreAuthor(t *testing.T) {
+	db := openTestDB(t)
+	createdAt := time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	if err := db.Create(&storage2.Author{ID: 1, Name: "Стругацкий", CreatedAt: createdAt}).Error; err != nil {
+		t.Fatal(err)
+	}
+	profile := &flibusta2.AuthorProfile{
+		ID:        1,
+		Name:      "Аркадий Натанович Стругацкий",
+		FirstName: "Аркадий",
+		LastName:  "Стругацкий",
+		Aliases:   []flibusta2.Author{{ID: 3, Name: "С. Ярославцев"}, {ID: 2, Name: "С. Витицкий"}},
+		Books:     []flibusta2.BibliographyEntry{{BookID: 9, Title: "Пикник на обочине", Role: flibusta2.RoleAuthor}},
+	}
+	if err := work.StoreAuthor(db, work.MapAuthorToStore(profile)); err != nil {
+		t.Fatalf("StoreAuthor() error = %v", err)
+	}
+	// псевдоним пропал со страницы, а библиография сменилась
+	profile.Aliases = profile.Aliases[:1]
+	profile.Books = []flibusta2.BibliographyEntry{{BookID: 10, Title: "Трудно быть богом", Role: flibusta2.RoleAuthor}}
+	if err := work.StoreAuthor(db, work.MapAuthorToStore(profile)); err != nil {
+		t.Fatalf("StoreAuthor() error = %v", err)
+	}
+	var author storage2.Author
+	if err := db.Preload("Aliases").Preload("Bibliography").First(&author, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !author.CreatedAt.Equal(createdAt) {
+		t.Errorf("stored author created at got = %v, want %v", author.CreatedAt, createdAt)
+	}
+	if author.Name != profile.Name || author.FirstName != "Аркадий" || author.ParsedAt == nil {
+		t.Errorf("stored author got = %+v", author)
+	}
+	var aliases, books []uint
+	for _, a := range author.Aliases {
+		aliases = append(aliases, a.ID)
+	}
+	for _, b := range author.Bibliography {
+		books = append(books, b.BookID)
+	}
+	if want := []uint{3}; !reflect.DeepEqual(aliases, want) {
+		t.Errorf("stored aliases got = %v, want %v", aliases, want)
+	}
+	if want := []uint{10}; !reflect.DeepEqual(books, want) {
+		t.Errorf("stored bibliography got = %v, want %v", books, want)
+	}
+}
+
+func TestStoreCover(t *testing.T) {
+	server := flibustatest.NewServer("../flibusta/test-pages", "reader", "secret")
+	defer server.Close()
+	var cover bytes.Buffer
+	if err := png.Encode(&cover, image.NewRGBA(image.Rect(0, 0, 120, 180))); err != nil {
+		t.Fatal(err)
+	}
+	server.Serve("/i/9/cover.png", cover.Bytes())
+	db := openTestDB(t)
+	flb := newTestClient(t, server)
+	dir, err := ioutil.TempDir("", "flibusta-covers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := covers.NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createdAt := time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	if err = db.Create(&storage2.Book{ID: 9, Title: "Пикник на обочине"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Create(&storage2.Cover{BookID: 9, Hash: "old", CreatedAt: createdAt}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// сессия истекла, клиент должен войти заново, а не получить редирект на страницу входа
+	server.ExpireSessions()
+	if err = work.StoreCover(context.Background(), db, flb, store, &flibusta2.Book{ID: 9, Cover: "/i/9/cover.png"}); err != nil {
+		t.Fatalf("StoreCover() error = %v", err)
+	}
+	if got := server.Logins(); got != 2 {
+		t.Errorf("logins got = %v, want %v", got, 2)
+	}
+	var stored storage2.Cover
+	if err = db.First(&stored, "book_id = ?", 9).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !stored.CreatedAt.Equal(createdAt) || stored.Hash == "old" || stored.Width != 120 || stored.Height != 180 {
+		t.Errorf("stored cover got = %+v", stored)
+	}
+}
@@ -1,12 +1,28 @@
 package work
 
 import (
+	"context"
+	"github.com/matperez/flibusta-parser/internal/covers"
 	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
 	storage2 "github.com/matperez/flibusta-parser/internal/storage"
+	"github.com/pkg/errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"log"
+	"sort"
+	"time"
 )
 
+//Options tunes what DoWork fetches in addition to the book page
+type Options struct {
+	// Covers stores downloaded covers, nil disables fetching
+	Covers *covers.Store
+	// Retry repeats the page requests failed with transient errors
+	Retry RetryPolicy
+	// Reviews enables storing the reviews of the users from the book page
+	Reviews bool
+}
+
 func CreateJobs(from, to int) []int {
 	var jobs []int
 
@@ -18,40 +34,356 @@ func CreateJobs(from, to int) []int {
 
 func MapBookToStore(b *flibusta2.Book) *storage2.Book {
 	model := &storage2.Book{
-		ID:         uint(b.ID),
-		Title:      b.Title,
-		Annotation: nil,
-		Authors:    []*storage2.Author{},
-		Genres:     []*storage2.Genre{},
+		ID:           uint(b.ID),
+		Title:        b.Title,
+		Annotation:   nil,
+		Contributors: []*storage2.BookAuthor{},
+		Genres:       []*storage2.Genre{},
 	}
 	if b.Annotation != "" && b.Annotation != "отсутствует" {
 		model.Annotation = &b.Annotation
 	}
 	model.ReadCount = uint(b.ReadCount)
-	for _, a := range b.Authors {
-		model.Authors = append(model.Authors, &storage2.Author{
-			ID:   uint(a.ID),
-			Name: a.Name,
+	model.RecommendationCount = uint(b.RecommendationCount)
+	model.FileRating = uint(b.FileRating)
+	model.Format = b.Format
+	model.Size = uint64(b.Size)
+	model.Pages = uint(b.Pages)
+	model.Year = uint(b.Year)
+	if !b.Added.IsZero() {
+		model.AddedAt = &b.Added
+	}
+	model.Status = string(b.Status)
+	if b.ReplacedBy != 0 {
+		replacedBy := uint(b.ReplacedBy)
+		model.ReplacedBy = &replacedBy
+	}
+	if b.Cover != "" {
+		model.Cover = &b.Cover
+	}
+	model.Series = []*storage2.BookSeries{}
+	for _, s := range b.Series {
+		model.Series = append(model.Series, &storage2.BookSeries{
+			BookID:   uint(b.ID),
+			SeriesID: uint(s.ID),
+			Number:   uint(s.Number),
+			Series: &storage2.Series{
+				ID:    uint(s.ID),
+				Title: s.Title,
+			},
+		})
+	}
+	// один человек хранится с одной ролью на книгу, первая роль на странице важнее
+	seen := map[int]bool{}
+	for _, a := range b.Contributors {
+		if seen[a.ID] {
+			continue
+		}
+		seen[a.ID] = true
+		model.Contributors = append(model.Contributors, &storage2.BookAuthor{
+			BookID:   uint(b.ID),
+			AuthorID: uint(a.ID),
+			Role:     string(a.Role),
+			Author: &storage2.Author{
+				ID:   uint(a.ID),
+				Name: a.Name,
+			},
 		})
 	}
 	for _, g := range b.Genres {
-		model.Genres = append(model.Genres, &storage2.Genre{
+		genre := &storage2.Genre{
 			ID:    uint(g.ID),
 			Title: g.Name,
+		}
+		if g.Code != "" {
+			code := g.Code
+			genre.Code = &code
+		}
+		if g.Group != "" {
+			group := g.Group
+			genre.GroupCode = &group
+		}
+		model.Genres = append(model.Genres, genre)
+	}
+	return model
+}
+
+//StoreCover downloads the book cover and records it
+func StoreCover(ctx context.Context, db *gorm.DB, flb flibusta2.Client, store *covers.Store, b *flibusta2.Book) error {
+	content, err := flb.GetCover(ctx, b.Cover)
+	if err != nil {
+		return err
+	}
+	img, err := store.Save(content)
+	if err != nil {
+		return err
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "book_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"hash", "mime_type", "width", "height", "size", "updated_at"}),
+	}).Create(&storage2.Cover{
+		BookID:   uint(b.ID),
+		Hash:     img.Hash,
+		MimeType: img.MimeType,
+		Width:    uint(img.Width),
+		Height:   uint(img.Height),
+		Size:     uint(img.Size),
+	}).Error
+}
+
+func MapAuthorToStore(a *flibusta2.AuthorProfile) *storage2.Author {
+	parsedAt := time.Now()
+	model := &storage2.Author{
+		ID:           uint(a.ID),
+		Name:         a.Name,
+		FirstName:    a.FirstName,
+		MiddleName:   a.MiddleName,
+		LastName:     a.LastName,
+		ParsedAt:     &parsedAt,
+		Aliases:      []*storage2.Author{},
+		Bibliography: []*storage2.BibliographyEntry{},
+	}
+	if a.Bio != "" {
+		model.Bio = &a.Bio
+	}
+	for _, alias := range a.Aliases {
+		model.Aliases = append(model.Aliases, &storage2.Author{
+			ID:   uint(alias.ID),
+			Name: alias.Name,
 		})
 	}
+	for i, b := range a.Books {
+		entry := &storage2.BibliographyEntry{
+			AuthorID: uint(a.ID),
+			BookID:   uint(b.BookID),
+			Role:     string(b.Role),
+			Position: uint(i),
+			Title:    b.Title,
+		}
+		if b.SeriesID != 0 {
+			seriesID := uint(b.SeriesID)
+			seriesTitle := b.SeriesTitle
+			entry.SeriesID = &seriesID
+			entry.SeriesTitle = &seriesTitle
+		}
+		model.Bibliography = append(model.Bibliography, entry)
+	}
 	return model
 }
 
-func DoWork(db *gorm.DB, flb flibusta2.Client, bookId int, workerId int) {
+//StoreAuthor upserts the author with the aliases and replaces the previously stored bibliography and alias links
+func StoreAuthor(db *gorm.DB, model *storage2.Author) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Save обновил бы все колонки и затер created_at уже сохраненного автора
+		err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "first_name", "middle_name", "last_name", "bio", "parsed_at", "updated_at"}),
+		}).Create(model).Error
+		if err != nil {
+			return err
+		}
+		aliases := append([]*storage2.Author(nil), model.Aliases...)
+		sort.Slice(aliases, func(i, j int) bool { return aliases[i].ID < aliases[j].ID })
+		if len(aliases) > 0 {
+			err = tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"name", "updated_at"}),
+			}).Create(&aliases).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err = tx.Table("author_aliases").Where("author_id = ?", model.ID).Delete(map[string]interface{}{}).Error; err != nil {
+			return err
+		}
+		var links []map[string]interface{}
+		for _, alias := range aliases {
+			links = append(links, map[string]interface{}{"author_id": model.ID, "alias_id": alias.ID})
+		}
+		if len(links) > 0 {
+			if err = tx.Table("author_aliases").Create(&links).Error; err != nil {
+				return err
+			}
+		}
+		if err = tx.Where("author_id = ?", model.ID).Delete(&storage2.BibliographyEntry{}).Error; err != nil {
+			return err
+		}
+		if len(model.Bibliography) == 0 {
+			return nil
+		}
+		for _, entry := range model.Bibliography {
+			entry.AuthorID = model.ID
+		}
+		return tx.Create(&model.Bibliography).Error
+	})
+}
+
+//MapReviewsToStore maps the reviews listed on the book page
+func MapReviewsToStore(bookId int, reviews []flibusta2.Review) []*storage2.Review {
+	var models []*storage2.Review
+	for _, r := range reviews {
+		model := &storage2.Review{
+			BookID:   uint(bookId),
+			UserID:   uint(r.UserID),
+			UserName: r.User,
+			Rating:   uint(r.Rating),
+			Text:     r.Text,
+		}
+		if !r.Date.IsZero() {
+			date := r.Date
+			model.ReviewedAt = &date
+		}
+		models = append(models, model)
+	}
+	return models
+}
+
+//StoreReviews upserts the reviews of the book by the user and deletes the stored ones no longer on the page
+func StoreReviews(db *gorm.DB, bookId int, reviews []*storage2.Review) error {
+	// на странице у пользователя одно впечатление, повторы отбрасываются, чтобы не обновлять строку дважды
+	var unique []*storage2.Review
+	var users []uint
+	seen := map[uint]bool{}
+	for _, r := range reviews {
+		if !seen[r.UserID] {
+			seen[r.UserID] = true
+			unique = append(unique, r)
+			users = append(users, r.UserID)
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		stale := tx.Where("book_id = ?", bookId)
+		if len(users) > 0 {
+			stale = stale.Where("user_id NOT IN ?", users)
+		}
+		if err := stale.Delete(&storage2.Review{}).Error; err != nil || len(unique) == 0 {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "book_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_name", "reviewed_at", "rating", "text", "updated_at"}),
+		}).Create(&unique).Error
+	})
+}
+
+//DoAuthorWork fetches and stores the author page, the error is logged and returned
+func DoAuthorWork(ctx context.Context, db *gorm.DB, flb flibusta2.Client, authorId int, workerId int) error {
+	log.Printf("worker [%d] - created processing author [%d]\n", workerId, authorId)
+	author, err := flb.GetAuthor(ctx, authorId)
+	if err != nil {
+		log.Printf("worker [%d] failed to fetch the author [%d]: %s", workerId, authorId, err.Error())
+		return err
+	}
+	if err = StoreAuthor(db, MapAuthorToStore(author)); err != nil {
+		log.Printf("worker [%d] failed to store the author [%d]: %s", workerId, authorId, err.Error())
+		return err
+	}
+	log.Printf("worker [%d] stored the author [%d]", workerId, authorId)
+	return nil
+}
+
+//StoreSeries saves the series and the order of its books which are already stored
+func StoreSeries(db *gorm.DB, s *flibusta2.Series) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"title", "updated_at"}),
+		}).Create(&storage2.Series{ID: uint(s.ID), Title: s.Title}).Error
+		if err != nil {
+			return err
+		}
+		var ids []uint
+		for _, b := range s.Books {
+			ids = append(ids, uint(b.ID))
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		var stored []uint
+		if err = tx.Model(&storage2.Book{}).Where("id IN ?", ids).Pluck("id", &stored).Error; err != nil {
+			return err
+		}
+		storedSet := map[uint]bool{}
+		for _, id := range stored {
+			storedSet[id] = true
+		}
+		var links []*storage2.BookSeries
+		for _, b := range s.Books {
+			if !storedSet[uint(b.ID)] {
+				continue
+			}
+			links = append(links, &storage2.BookSeries{
+				BookID:   uint(b.ID),
+				SeriesID: uint(s.ID),
+				Number:   uint(b.Number),
+			})
+		}
+		if len(links) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "book_id"}, {Name: "series_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"number"}),
+		}).Create(&links).Error
+	})
+}
+
+//DoSeriesWork fetches and stores the series page, the error is logged and returned
+func DoSeriesWork(ctx context.Context, db *gorm.DB, flb flibusta2.Client, seriesId int, workerId int) error {
+	log.Printf("worker [%d] - created processing series [%d]\n", workerId, seriesId)
+	series, err := flb.GetSeries(ctx, seriesId)
+	if err != nil {
+		log.Printf("worker [%d] failed to fetch the series [%d]: %s", workerId, seriesId, err.Error())
+		return err
+	}
+	if err = StoreSeries(db, series); err != nil {
+		log.Printf("worker [%d] failed to store the series [%d]: %s", workerId, seriesId, err.Error())
+		return err
+	}
+	log.Printf("worker [%d] stored the series [%d]", workerId, seriesId)
+	return nil
+}
+
+//DoWork fetches and stores the book page, the error is logged and returned
+func DoWork(ctx context.Context, db *gorm.DB, flb flibusta2.Client, opts Options, bookId int, workerId int) error {
 	log.Printf("worker [%d] - created processing book [%d]\n", workerId, bookId)
-	book, err := flb.GetBook(bookId)
+	var book *flibusta2.Book
+	err := opts.Retry.Do(ctx, func() (err error) {
+		book, err = flb.GetBook(ctx, bookId)
+		return err
+	})
 	if err != nil {
-		log.Printf("worker [%d] failed to fetch the book [%d]: %s", workerId, bookId, err.Error())
-		return
+		log.Printf("worker [%d] failed to fetch the book [%d] (%s): %s", workerId, bookId, flibusta2.ClassOf(err), err.Error())
+		recordCrawlAttempt(db, workerId, bookId, err)
+		return err
 	}
 	model := MapBookToStore(book)
-	db.Create(&model)
-	db.Save(&model)
-	log.Printf("worker [%d] stored the book [%d]", workerId, bookId)
+	result, err := storage2.UpsertBook(db, model)
+	if err != nil {
+		err = errors.Wrap(err, "error storing the book")
+		log.Printf("worker [%d] failed to store the book [%d]: %s", workerId, bookId, err.Error())
+		recordCrawlAttempt(db, workerId, bookId, err)
+		return err
+	}
+	recordCrawlAttempt(db, workerId, bookId, nil)
+	log.Printf("worker [%d] stored the book [%d]: %s", workerId, bookId, result)
+	if err = RecordReadCount(db, model, time.Now()); err != nil {
+		log.Printf("worker [%d] failed to record the read count of the book [%d]: %s", workerId, bookId, err.Error())
+		return err
+	}
+	if opts.Reviews {
+		if err = StoreReviews(db, bookId, MapReviewsToStore(bookId, book.Reviews)); err != nil {
+			log.Printf("worker [%d] failed to store the reviews of the book [%d]: %s", workerId, bookId, err.Error())
+			return err
+		}
+		log.Printf("worker [%d] stored %d reviews of the book [%d]", workerId, len(book.Reviews), bookId)
+	}
+	if opts.Covers != nil && book.Cover != "" {
+		if err = StoreCover(ctx, db, flb, opts.Covers, book); err != nil {
+			log.Printf("worker [%d] failed to store the cover of the book [%d]: %s", workerId, bookId, err.Error())
+			return err
+		}
+		log.Printf("worker [%d] stored the cover of the book [%d]", workerId, bookId)
+	}
+	return nil
 }
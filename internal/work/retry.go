@@ -0,0 +1,60 @@
+package work
+
+import (
+	"context"
+	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
+	"time"
+)
+
+//RetryPolicy repeats the requests failed with transient errors, the other failures are returned at once
+type RetryPolicy struct {
+	//Attempts is the total number of tries, zero means a single one
+	Attempts int
+	//Backoff is the delay before the second try, it doubles on every retry
+	Backoff time.Duration
+	//MaxBackoff limits the delay
+	MaxBackoff time.Duration
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+//DefaultRetryPolicy rides out short network and site outages
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   4,
+	Backoff:    2 * time.Second,
+	MaxBackoff: time.Minute,
+}
+
+//Do calls fn until it succeeds, fails with a permanent error, the attempts run out or the context is done
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	sleep := p.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	delay := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts || !flibusta2.IsRetryable(err) {
+			return err
+		}
+		// после отмены контекста повторять нечего, возвращается последняя ошибка запроса
+		if ctx.Err() != nil || sleep(ctx, delay) != nil {
+			return err
+		}
+		delay *= 2
+		if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+			delay = p.MaxBackoff
+		}
+	}
+}
+
+//sleepContext waits for the duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,78 @@
+package work
+
+import (
+	"context"
+	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
+	"github.com/pkg/errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Do(t *testing.T) {
+	t.Parallel()
+	transient := &flibusta2.Error{Class: flibusta2.ErrTransient, Err: errors.New("connection reset")}
+	notFound := &flibusta2.Error{Class: flibusta2.ErrNotFound, StatusCode: 404, Err: errors.New("not found")}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantErr   error
+		wantCalls int
+		wantSleep []time.Duration
+	}{
+		{name: "Success", errs: []error{nil}, wantCalls: 1},
+		{name: "Transient then success", errs: []error{transient, transient, nil}, wantCalls: 3, wantSleep: []time.Duration{time.Second, 2 * time.Second}},
+		{name: "Permanent", errs: []error{notFound}, wantErr: notFound, wantCalls: 1},
+		{name: "Attempts run out", errs: []error{transient, transient, transient, transient, nil}, wantErr: transient, wantCalls: 4, wantSleep: []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var slept []time.Duration
+			policy := RetryPolicy{Attempts: 4, Backoff: time.Second, MaxBackoff: 3 * time.Second}
+			policy.sleep = func(ctx context.Context, d time.Duration) error {
+				slept = append(slept, d)
+				return nil
+			}
+			var calls int
+			err := policy.Do(context.Background(), func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			if err != tt.wantErr {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("Do() got calls = %v, want calls %v", calls, tt.wantCalls)
+			}
+			if !reflect.DeepEqual(slept, tt.wantSleep) {
+				t.Errorf("Do() got delays = %v, want delays %v", slept, tt.wantSleep)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Do_cancelled(t *testing.T) {
+	t.Parallel()
+	transient := &flibusta2.Error{Class: flibusta2.ErrTransient, Err: errors.New("connection reset")}
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{Attempts: 4, Backoff: time.Hour}
+	var calls int
+	start := time.Now()
+	// отмена во время паузы между попытками прерывает ожидание
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err := policy.Do(ctx, func() error {
+		calls++
+		return transient
+	})
+	if err != transient {
+		t.Errorf("Do() error = %v, wantErr %v", err, transient)
+	}
+	if calls != 1 {
+		t.Errorf("Do() got calls = %v, want calls %v", calls, 1)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Do() waited %v after the context was cancelled", elapsed)
+	}
+}
@@ -0,0 +1,30 @@
+package work
+
+import (
+	"context"
+	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
+	storage2 "github.com/matperez/flibusta-parser/internal/storage"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"log"
+)
+
+//SyncJobs returns the IDs of the books added to the site after the last stored book
+//and after the last queued one, zero if nothing is queued yet
+func SyncJobs(ctx context.Context, db *gorm.DB, flb flibusta2.Client, queued int) ([]int, error) {
+	latest, err := flb.GetLatestBookID(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the latest book ID")
+	}
+	var stored int
+	if err = db.Model(&storage2.Book{}).Select("COALESCE(MAX(id), 0)").Scan(&stored).Error; err != nil {
+		return nil, errors.Wrap(err, "error getting the last stored book ID")
+	}
+	// книги в очереди и отсутствующие на сайте не попадают в базу и не должны ставиться в очередь на каждой проверке
+	from := stored
+	if queued > from {
+		from = queued
+	}
+	log.Printf("the latest book is [%d], the last stored one is [%d], the last queued one is [%d]", latest, stored, queued)
+	return CreateJobs(from+1, latest+1), nil
+}
@@ -0,0 +1,192 @@
+package work
+
+import (
+	storage2 "github.com/matperez/flibusta-parser/internal/storage"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+//TrendingBook is a book ranked by the growth of its read count
+type TrendingBook struct {
+	BookID    uint
+	Title     string
+	ReadCount uint
+	// Growth is the read count gained in the window
+	Growth int
+	// PerDay is the growth per day between the first and the last sample in the window
+	PerDay float64
+}
+
+//RecrawlPolicy tells how often the stored books are parsed again
+type RecrawlPolicy struct {
+	// Window is the period the read count velocity is measured in
+	Window time.Duration
+	// HotVelocity is the reads per day making a book hot
+	HotVelocity float64
+	// HotAge is the age of the last crawl of a hot book to parse it again
+	HotAge time.Duration
+	// ColdAge is the age of the last crawl of the other books to parse them again
+	ColdAge time.Duration
+}
+
+//RecordReadCount appends the read and recommendation counts and the file rating of the book
+//observed at the time to its time series
+func RecordReadCount(db *gorm.DB, book *storage2.Book, observedAt time.Time) error {
+	return db.Create(&storage2.ReadCountSample{
+		BookID:              book.ID,
+		ReadCount:           book.ReadCount,
+		RecommendationCount: book.RecommendationCount,
+		FileRating:          book.FileRating,
+		ObservedAt:          observedAt,
+	}).Error
+}
+
+//Trending ranks the books sampled at least twice since now minus the window by the read count velocity,
+//zero limit returns all of them
+func Trending(db *gorm.DB, window time.Duration, now time.Time, limit int) ([]*TrendingBook, error) {
+	books, err := rankByVelocity(db, window, now)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(books) > limit {
+		books = books[:limit]
+	}
+	if err = fillTrendingTitles(db, books); err != nil {
+		return nil, err
+	}
+	return books, nil
+}
+
+//rankByVelocity ranks the books like Trending without loading the titles
+func rankByVelocity(db *gorm.DB, window time.Duration, now time.Time) ([]*TrendingBook, error) {
+	// выборки только добавляются, поэтому первая и последняя в окне - это наименьший и наибольший ID
+	var bounds []struct {
+		BookID  uint
+		FirstID uint
+		LastID  uint
+	}
+	err := db.Model(&storage2.ReadCountSample{}).
+		Select("book_id, MIN(id) AS first_id, MAX(id) AS last_id").
+		Where("observed_at >= ?", now.Add(-window)).
+		Group("book_id").
+		Having("COUNT(*) > 1").
+		Scan(&bounds).Error
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint
+	for _, b := range bounds {
+		ids = append(ids, b.FirstID, b.LastID)
+	}
+	samples := map[uint]*storage2.ReadCountSample{}
+	for start := 0; start < len(ids); start += 1000 {
+		end := start + 1000
+		if end > len(ids) {
+			end = len(ids)
+		}
+		var chunk []*storage2.ReadCountSample
+		if err = db.Where("id IN ?", ids[start:end]).Find(&chunk).Error; err != nil {
+			return nil, err
+		}
+		for _, s := range chunk {
+			samples[s.ID] = s
+		}
+	}
+	var books []*TrendingBook
+	for _, b := range bounds {
+		first, last := samples[b.FirstID], samples[b.LastID]
+		if first == nil || last == nil {
+			continue
+		}
+		days := last.ObservedAt.Sub(first.ObservedAt).Hours() / 24
+		if days <= 0 {
+			continue
+		}
+		growth := int(last.ReadCount) - int(first.ReadCount)
+		books = append(books, &TrendingBook{
+			BookID:    b.BookID,
+			ReadCount: last.ReadCount,
+			Growth:    growth,
+			PerDay:    float64(growth) / days,
+		})
+	}
+	sort.Slice(books, func(i, j int) bool {
+		if books[i].PerDay != books[j].PerDay {
+			return books[i].PerDay > books[j].PerDay
+		}
+		return books[i].BookID < books[j].BookID
+	})
+	return books, nil
+}
+
+func fillTrendingTitles(db *gorm.DB, books []*TrendingBook) error {
+	if len(books) == 0 {
+		return nil
+	}
+	byID := map[uint]*TrendingBook{}
+	var ids []uint
+	for _, b := range books {
+		byID[b.BookID] = b
+		ids = append(ids, b.BookID)
+	}
+	var stored []*storage2.Book
+	if err := db.Select("id", "title").Where("id IN ?", ids).Find(&stored).Error; err != nil {
+		return err
+	}
+	for _, s := range stored {
+		byID[s.ID].Title = s.Title
+	}
+	return nil
+}
+
+//DueBooks returns the stored and the failed books to parse again: the hot ones crawled before now minus the hot age first,
+//then the others crawled before now minus the cold age, the oldest crawls first
+func DueBooks(db *gorm.DB, now time.Time, policy RecrawlPolicy) ([]int, error) {
+	// неудачные попытки тоже повторяются, иначе книга с разовой ошибкой больше не обновится
+	statuses := []string{string(CrawlDone), string(CrawlFailed)}
+	trending, err := rankByVelocity(db, policy.Window, now)
+	if err != nil {
+		return nil, err
+	}
+	var hot []int
+	for _, b := range trending {
+		if b.PerDay >= policy.HotVelocity {
+			hot = append(hot, int(b.BookID))
+		}
+	}
+	var due []int
+	for start := 0; start < len(hot); start += 1000 {
+		end := start + 1000
+		if end > len(hot) {
+			end = len(hot)
+		}
+		var chunk []int
+		err = db.Model(&storage2.CrawlAttempt{}).
+			Where("status IN ? AND last_attempted_at < ? AND book_id IN ?", statuses, now.Add(-policy.HotAge), hot[start:end]).
+			Order("last_attempted_at").
+			Pluck("book_id", &chunk).Error
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, chunk...)
+	}
+	var cold []int
+	err = db.Model(&storage2.CrawlAttempt{}).
+		Where("status IN ? AND last_attempted_at < ?", statuses, now.Add(-policy.ColdAge)).
+		Order("last_attempted_at").
+		Pluck("book_id", &cold).Error
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int]bool, len(due))
+	for _, id := range due {
+		seen[id] = true
+	}
+	for _, id := range cold {
+		if !seen[id] {
+			due = append(due, id)
+		}
+	}
+	return due, nil
+}
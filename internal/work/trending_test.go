@@ -0,0 +1,82 @@
+package work_test
+
+import (
+	flibusta2 "github.com/matperez/flibusta-parser/internal/flibusta"
+	storage2 "github.com/matperez/flibusta-parser/internal/storage"
+	"github.com/matperez/flibusta-parser/internal/work"
+	"github.com/pkg/errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTrendingAndDueBooks(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	// книга 1 набирает 100 прочтений в день, книга 2 - 5, у книги 3 одна выборка в окне
+	samples := []struct {
+		bookID    uint
+		readCount uint
+		ago       time.Duration
+	}{
+		{1, 1000, 10 * day},
+		{1, 1100, 4 * day},
+		{1, 1400, day},
+		{2, 500, 6 * day},
+		{2, 510, 4 * day},
+		{2, 530, 0},
+		{3, 10, 20 * day},
+		{3, 40, day},
+	}
+	for _, s := range samples {
+		book := &storage2.Book{ID: s.bookID, Title: "Книга", ReadCount: s.readCount}
+		if err := db.Save(book).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := work.RecordReadCount(db, book, now.Add(-s.ago)); err != nil {
+			t.Fatalf("RecordReadCount() error = %v", err)
+		}
+	}
+
+	trending, err := work.Trending(db, 7*day, now, 10)
+	if err != nil {
+		t.Fatalf("Trending() error = %v", err)
+	}
+	var got []work.TrendingBook
+	for _, b := range trending {
+		got = append(got, *b)
+	}
+	want := []work.TrendingBook{
+		{BookID: 1, Title: "Книга", ReadCount: 1400, Growth: 300, PerDay: 100},
+		{BookID: 2, Title: "Книга", ReadCount: 530, Growth: 30, PerDay: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Trending() got = %+v, want %+v", got, want)
+	}
+
+	// книга 4 не загрузилась, книга 5 отсутствует на сайте
+	crawls := map[int]struct {
+		err error
+		ago time.Duration
+	}{
+		1: {nil, 2 * day},
+		2: {nil, 2 * day},
+		3: {nil, 40 * day},
+		4: {&flibusta2.Error{Class: flibusta2.ErrTransient, Err: errors.New("timeout")}, 35 * day},
+		5: {&flibusta2.Error{Class: flibusta2.ErrNotFound, Err: errors.New("not found")}, 50 * day},
+	}
+	for id, crawl := range crawls {
+		if err = work.RecordCrawlAttempt(db, id, crawl.err); err != nil {
+			t.Fatal(err)
+		}
+		db.Model(&storage2.CrawlAttempt{}).Where("book_id = ?", id).Update("last_attempted_at", now.Add(-crawl.ago))
+	}
+	due, err := work.DueBooks(db, now, work.RecrawlPolicy{Window: 7 * day, HotVelocity: 50, HotAge: day, ColdAge: 30 * day})
+	if err != nil {
+		t.Fatalf("DueBooks() error = %v", err)
+	}
+	if want := []int{1, 3, 4}; !reflect.DeepEqual(due, want) {
+		t.Errorf("DueBooks() got = %v, want %v", due, want)
+	}
+}